@@ -0,0 +1,109 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	corsAnyOrigin  = "*"
+	allowedMethods = "GET, OPTIONS"
+)
+
+// CORSConfig defines the Cross-Origin Resource Sharing behavior of the WebFinger endpoint (RFC 7033 section 5).
+type CORSConfig struct {
+	// Origins allowed to query the endpoint, "*" (the default) allows any origin
+	AllowedOrigins []string `json:"allowedOrigins,omitempty" yaml:"allowedOrigins"`
+	// Response headers browser clients are allowed to read
+	ExposedHeaders []string `json:"exposedHeaders,omitempty" yaml:"exposedHeaders"`
+	// How long, in seconds, browsers may cache the result of a preflight request
+	MaxAge int `json:"maxAge,omitempty" yaml:"maxAge"`
+}
+
+// corsPolicy is the validated form of CORSConfig.
+type corsPolicy struct {
+	anyOrigin      bool
+	origins        map[string]struct{}
+	exposedHeaders string
+	maxAge         string
+}
+
+// newCORSPolicy validates the CORS configuration.
+func newCORSPolicy(config CORSConfig) (*corsPolicy, error) {
+	if config.MaxAge < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidCORSMaxAge, config.MaxAge)
+	}
+
+	policy := &corsPolicy{
+		// RFC 7033 requires "*" unless the operator restricts it explicitly
+		anyOrigin:      len(config.AllowedOrigins) == 0,
+		origins:        make(map[string]struct{}, len(config.AllowedOrigins)),
+		exposedHeaders: strings.Join(config.ExposedHeaders, ", "),
+	}
+
+	if config.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(config.MaxAge)
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if origin == corsAnyOrigin {
+			policy.anyOrigin = true
+			continue
+		}
+
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || strings.TrimSuffix(parsed.Path, "/") != "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCORSOrigin, origin)
+		}
+
+		policy.origins[strings.ToLower(parsed.Scheme+"://"+parsed.Host)] = struct{}{}
+	}
+
+	return policy, nil
+}
+
+// setHeaders adds the CORS response headers and reports whether the request's origin is allowed.
+func (c *corsPolicy) setHeaders(header http.Header, req *http.Request) bool {
+	if c.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", corsAnyOrigin)
+	} else {
+		header.Add("Vary", "Origin")
+
+		origin := req.Header.Get("Origin")
+		if _, ok := c.origins[strings.ToLower(origin)]; !ok {
+			return false
+		}
+
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if c.exposedHeaders != "" {
+		header.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+	}
+
+	return true
+}
+
+// servePreflight answers an OPTIONS request.
+func (c *corsPolicy) servePreflight(rw http.ResponseWriter, req *http.Request) {
+	header := rw.Header()
+	header.Set("Allow", allowedMethods)
+
+	if c.setHeaders(header, req) && req.Header.Get("Access-Control-Request-Method") != "" {
+		header.Set("Access-Control-Allow-Methods", allowedMethods)
+
+		if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+
+		if c.maxAge != "" {
+			header.Set("Access-Control-Max-Age", c.maxAge)
+		}
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
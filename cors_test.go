@@ -0,0 +1,122 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSDefault(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	for _, target := range []string{
+		"/.well-known/webfinger?resource=acct:alice@example.com",
+		"/.well-known/webfinger?resource=acct:bob@example.com",
+		"/.well-known/webfinger",
+	} {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Origin", "https://app.example.net")
+
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"), target)
+	}
+
+	// Non-WebFinger requests are left alone
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/other", nil))
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.CORS = traefik_webfinger.CORSConfig{
+		AllowedOrigins: []string{"https://app.example.net"},
+		ExposedHeaders: []string{"Link"},
+		MaxAge:         600,
+	}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// Allowed origin
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/.well-known/webfinger", nil)
+	req.Header.Set("Origin", "https://app.example.net")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "Accept")
+
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "https://app.example.net", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, OPTIONS", recorder.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Accept", recorder.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Link", recorder.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "600", recorder.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, recorder.Header().Values("Vary"), "Origin")
+
+	// Disallowed origin
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodOptions, "/.well-known/webfinger", nil)
+	req.Header.Set("Origin", "https://evil.example.org")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Methods"))
+
+	// Other methods are still rejected
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/.well-known/webfinger", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, "GET, OPTIONS", recorder.Header().Get("Allow"))
+}
+
+func TestCORSConfigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cors traefik_webfinger.CORSConfig
+	}{
+		{name: "Negative max age", cors: traefik_webfinger.CORSConfig{MaxAge: -1}},
+		{name: "Origin without scheme", cors: traefik_webfinger.CORSConfig{AllowedOrigins: []string{"app.example.net"}}},
+		{name: "Origin with path", cors: traefik_webfinger.CORSConfig{AllowedOrigins: []string{"https://app.example.net/path"}}},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.CORS = tt.cors
+
+			_, err := traefik_webfinger.New(context.Background(), next, cfg, "test")
+			assert.Error(t, err)
+		})
+	}
+}
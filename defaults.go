@@ -0,0 +1,81 @@
+package traefik_webfinger
+
+import (
+	"sort"
+)
+
+// excludeAllDefaults opts a resource out of every default link and property.
+const excludeAllDefaults = "*"
+
+// responseDefaults holds the link profiles resources reference and the links and properties added to every
+// configured response.
+type responseDefaults struct {
+	profiles linkProfiles
+	defaults linkProfile
+}
+
+// newResponseDefaults validates the default links and properties.
+func newResponseDefaults(links []WebFingerLink, properties map[string]*string, profiles linkProfiles) (responseDefaults, error) {
+	if err := validateLinks("defaultLinks", links); err != nil {
+		return responseDefaults{}, err
+	}
+
+	if err := validateProperties("defaultProperties", properties); err != nil {
+		return responseDefaults{}, err
+	}
+
+	return responseDefaults{profiles: profiles, defaults: linkProfile{links: links, properties: properties}}, nil
+}
+
+// apply returns a copy of the response with the links and properties of its profiles added in order, then the
+// defaults it doesn't exclude. A link rel or property name set by an earlier layer hides it in the later ones.
+// The profile references and exclusions are dropped from the copy, as they are not part of the served document.
+func (d responseDefaults) apply(response WebFingerResponse) WebFingerResponse {
+	excluded := make(map[string]struct{}, len(response.ExcludeDefaults))
+	for _, name := range response.ExcludeDefaults {
+		excluded[name] = struct{}{}
+	}
+
+	layer := linkProfile{links: response.Links, properties: response.Properties}
+
+	for _, name := range response.Profiles {
+		layer = layer.overlay(d.profiles[name], nil)
+	}
+
+	if _, ok := excluded[excludeAllDefaults]; !ok {
+		layer = layer.overlay(d.defaults, excluded)
+	}
+
+	response.Links, response.Properties = layer.links, layer.properties
+	response.Profiles, response.ExcludeDefaults = nil, nil
+
+	return response
+}
+
+// load returns the resource ready to be served, with the defaults applied and its validity windows parsed.
+func (d responseDefaults) load(resource string, response WebFingerResponse) (resourceEntry, error) {
+	return newResourceEntry(resource, d.apply(response))
+}
+
+// loadAll loads every resource.
+func (d responseDefaults) loadAll(resources map[string]WebFingerResponse) (map[string]resourceEntry, error) {
+	names := make([]string, 0, len(resources))
+	for resource := range resources {
+		names = append(names, resource)
+	}
+
+	sort.Strings(names)
+
+	loaded := make(map[string]resourceEntry, len(resources))
+
+	for _, resource := range names {
+		entry, err := d.load(resource, resources[resource])
+		if err != nil {
+			return nil, err
+		}
+
+		loaded[resource] = entry
+	}
+
+	return loaded, nil
+}
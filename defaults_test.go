@@ -0,0 +1,118 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const issuerRel = "http://openid.net/specs/connect/1.0/issuer"
+
+func TestDefaultLinksAndProperties(t *testing.T) {
+	resourcesFile := filepath.Join(t.TempDir(), "resources.json")
+	writeResourcesFile(t, resourcesFile, `{"acct:carol@example.com": {"subject": "acct:carol@example.com", "excludeDefaults": ["*"]}}`, time.Now())
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = resourcesFile
+	cfg.DefaultLinks = []traefik_webfinger.WebFingerLink{
+		{Rel: issuerRel, Href: "https://auth.example.com"},
+		{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/avatar.png"},
+	}
+	cfg.DefaultProperties = propertyMap(map[string]string{
+		"http://example.com/ns/organization": "Example Inc.",
+		"http://example.com/ns/team":         "unknown",
+	})
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Links:   []traefik_webfinger.WebFingerLink{{Rel: "self", Href: "https://example.com/users/alice"}},
+		},
+		"acct:bob@example.com": {
+			Subject:         "acct:bob@example.com",
+			Properties:      propertyMap(map[string]string{"http://example.com/ns/team": "payments"}),
+			Links:           []traefik_webfinger.WebFingerLink{{Rel: issuerRel, Href: "https://partners.example.com"}},
+			ExcludeDefaults: []string{"http://webfinger.net/rel/avatar", "http://example.com/ns/organization"},
+		},
+	}
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@example.com": {Subject: "acct:{user}@example.com"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	get := func(resource string) traefik_webfinger.WebFingerResponse {
+		recorder := getResource(handler, resource)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "excludeDefaults")
+
+		var response traefik_webfinger.WebFingerResponse
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+		return response
+	}
+
+	// Defaults are appended after the resource's own links
+	response := get("acct:alice@example.com")
+	assert.Equal(t, []traefik_webfinger.WebFingerLink{
+		{Rel: "self", Href: "https://example.com/users/alice"},
+		{Rel: issuerRel, Href: "https://auth.example.com"},
+		{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/avatar.png"},
+	}, response.Links)
+	assert.Equal(t, cfg.DefaultProperties, response.Properties)
+
+	// Links and properties of the resource override the defaults, and exclusions drop them
+	response = get("acct:bob@example.com")
+	assert.Equal(t, []traefik_webfinger.WebFingerLink{{Rel: issuerRel, Href: "https://partners.example.com"}}, response.Links)
+	assert.Equal(t, propertyMap(map[string]string{"http://example.com/ns/team": "payments"}), response.Properties)
+
+	// Templates and external sources get the defaults as well
+	response = get("acct:dave@example.com")
+	assert.Len(t, response.Links, 2)
+	assert.Equal(t, cfg.DefaultProperties, response.Properties)
+
+	response = get("acct:carol@example.com")
+	assert.Empty(t, response.Links)
+	assert.Empty(t, response.Properties)
+}
+
+func TestDefaultsInXRD(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.DefaultProperties = propertyMap(map[string]string{"http://example.com/ns/organization": "Example Inc."})
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Header.Set("Accept", "application/xrd+xml")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `<Property type="http://example.com/ns/organization">Example Inc.</Property>`)
+}
+
+func TestDefaultLinksValidation(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.DefaultLinks = []traefik_webfinger.WebFingerLink{{Href: "https://auth.example.com"}}
+
+	_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrRelRequired)
+}
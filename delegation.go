@@ -0,0 +1,123 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DelegationRule redirects WebFinger queries to another WebFinger server.
+// A rule without domain and pattern is a fallback, only applied to resources that are not found locally.
+type DelegationRule struct {
+	// Configured domain whose resources are delegated
+	Domain string `json:"domain,omitempty" yaml:"domain"`
+	// Resource pattern such as acct:{user}@example.com
+	Pattern string `json:"pattern,omitempty" yaml:"pattern"`
+	// Base URL of the server handling the delegated resources, such as https://social.example.com
+	Target string `json:"target,omitempty" yaml:"target"`
+	// Redirect status code, 307 by default
+	Status int `json:"status,omitempty" yaml:"status"`
+}
+
+// delegation is a validated DelegationRule.
+type delegation struct {
+	domain   string
+	matcher  *regexp.Regexp
+	location string
+	status   int
+}
+
+// newDelegations validates the delegation rules, keeping their order.
+func newDelegations(rules []DelegationRule, domains []string) ([]delegation, error) {
+	delegations := make([]delegation, 0, len(rules))
+
+	for i, rule := range rules {
+		target, err := url.Parse(rule.Target)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" ||
+			target.RawQuery != "" || target.Fragment != "" {
+			return nil, fmt.Errorf("%w: rule %d: target %q", ErrInvalidDelegation, i, rule.Target)
+		}
+
+		compiled := delegation{
+			domain:   rule.Domain,
+			location: strings.TrimSuffix(target.String(), "/") + webfingerPath,
+			status:   rule.Status,
+		}
+
+		switch rule.Status {
+		case 0:
+			compiled.status = http.StatusTemporaryRedirect
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("%w: rule %d: status %d", ErrInvalidDelegation, i, rule.Status)
+		}
+
+		if rule.Domain != "" && !isConfiguredDomain(rule.Domain, domains) {
+			return nil, fmt.Errorf("%w: rule %d: domain %s is not configured", ErrInvalidDelegation, i, rule.Domain)
+		}
+
+		if rule.Pattern != "" {
+			if compiled.matcher, err = compileTemplatePattern(rule.Pattern); err != nil {
+				return nil, err
+			}
+
+			if _, ok := matchDomain(templateSample(rule.Pattern), domains); !ok {
+				return nil, fmt.Errorf("%w: %s for domains %s", ErrResourceDomainMatch, rule.Pattern, strings.Join(domains, ", "))
+			}
+		}
+
+		delegations = append(delegations, compiled)
+	}
+
+	return delegations, nil
+}
+
+// fallback reports whether the rule only applies to resources that are not found locally.
+func (d delegation) fallback() bool {
+	return d.domain == "" && d.matcher == nil
+}
+
+// matches reports whether the resource is delegated by the rule.
+func (d delegation) matches(resource string) bool {
+	if d.domain != "" && !isResourceForDomain(resource, d.domain) {
+		return false
+	}
+
+	return d.matcher == nil || d.matcher.MatchString(foldResourceHost(resource))
+}
+
+// delegate redirects the request using the first matching rule, either among the fallback rules or the others.
+// It reports whether the request was answered.
+func (w *WebFinger) delegate(responseWriter http.ResponseWriter, req *http.Request, resource string, fallback bool) bool {
+	for _, rule := range w.delegations {
+		if rule.fallback() != fallback || !rule.matches(resource) {
+			continue
+		}
+
+		// The original query string is preserved so rel filters still apply on the remote server
+		location := rule.location
+		if req.URL.RawQuery != "" {
+			location += "?" + req.URL.RawQuery
+		}
+
+		w.cors.setHeaders(responseWriter.Header(), req)
+		http.Redirect(responseWriter, req, location, rule.status)
+
+		return true
+	}
+
+	return false
+}
+
+// isConfiguredDomain reports whether the domain is one of the configured ones.
+func isConfiguredDomain(domain string, domains []string) bool {
+	for _, configured := range domains {
+		if strings.EqualFold(domain, configured) {
+			return true
+		}
+	}
+
+	return false
+}
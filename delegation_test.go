@@ -0,0 +1,149 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegation(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domains = []string{"example.com", "example.org", "example.net"}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+	cfg.Delegations = []traefik_webfinger.DelegationRule{
+		{Pattern: "acct:{user}@example.com", Target: "https://social.example.com/"},
+		{Domain: "example.org", Target: "https://social.example.org", Status: http.StatusMovedPermanently},
+		{Target: "https://fallback.example.net"},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{
+			name:             "Pattern before local resources",
+			query:            "resource=acct:alice@example.com&rel=self",
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://social.example.com/.well-known/webfinger?resource=acct:alice@example.com&rel=self",
+		},
+		{
+			name:             "Pattern with a differently cased host",
+			query:            "resource=acct:bob@Example.COM",
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://social.example.com/.well-known/webfinger?resource=acct:bob@Example.COM",
+		},
+		{
+			name:             "Domain",
+			query:            "resource=acct%3Abob%40example.org",
+			expectedCode:     http.StatusMovedPermanently,
+			expectedLocation: "https://social.example.org/.well-known/webfinger?resource=acct%3Abob%40example.org",
+		},
+		{
+			name:             "Fallback",
+			query:            "resource=https://example.com/about",
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://fallback.example.net/.well-known/webfinger?resource=https://example.com/about",
+		},
+		{
+			name:         "Other domains are not delegated",
+			query:        "resource=acct:bob@example.edu",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?"+tt.query, nil))
+
+			assert.Equal(t, tt.expectedCode, recorder.Code)
+			assert.Equal(t, tt.expectedLocation, recorder.Header().Get("Location"))
+		})
+	}
+}
+
+func TestDelegationFallbackAfterLocalResources(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+	cfg.Delegations = []traefik_webfinger.DelegationRule{{Target: "https://social.example.com"}}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:alice@example.com"))
+	assert.Equal(t, http.StatusTemporaryRedirect, statusOf(handler, "acct:bob@example.com"))
+}
+
+func TestDelegationValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     traefik_webfinger.DelegationRule
+		expected error
+	}{
+		{name: "Missing target", rule: traefik_webfinger.DelegationRule{}, expected: traefik_webfinger.ErrInvalidDelegation},
+		{
+			name:     "Relative target",
+			rule:     traefik_webfinger.DelegationRule{Target: "/webfinger"},
+			expected: traefik_webfinger.ErrInvalidDelegation,
+		},
+		{
+			name:     "Target with query",
+			rule:     traefik_webfinger.DelegationRule{Target: "https://social.example.com/?a=b"},
+			expected: traefik_webfinger.ErrInvalidDelegation,
+		},
+		{
+			name:     "Unsupported status",
+			rule:     traefik_webfinger.DelegationRule{Target: "https://social.example.com", Status: http.StatusOK},
+			expected: traefik_webfinger.ErrInvalidDelegation,
+		},
+		{
+			name:     "Unknown domain",
+			rule:     traefik_webfinger.DelegationRule{Domain: "example.org", Target: "https://social.example.com"},
+			expected: traefik_webfinger.ErrInvalidDelegation,
+		},
+		{
+			name:     "Pattern without placeholder",
+			rule:     traefik_webfinger.DelegationRule{Pattern: "acct:bob@example.com", Target: "https://social.example.com"},
+			expected: traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name:     "Pattern of another domain",
+			rule:     traefik_webfinger.DelegationRule{Pattern: "acct:{user}@example.org", Target: "https://social.example.com"},
+			expected: traefik_webfinger.ErrResourceDomainMatch,
+		},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.Delegations = []traefik_webfinger.DelegationRule{tt.rule}
+
+			_, err := traefik_webfinger.New(context.Background(), next, cfg, "test")
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Subject modes of domain aliases.
+const (
+	aliasSubjectCanonical = "canonical"
+	aliasSubjectRewrite   = "rewrite"
+)
+
+// DomainAlias answers the resources of a secondary domain with the resources of a configured one.
+type DomainAlias struct {
+	// Secondary domain, such as example.co.uk
+	Domain string `json:"domain,omitempty" yaml:"domain"`
+	// Configured domain holding the resources, such as example.com
+	Target string `json:"target,omitempty" yaml:"target"`
+	// Subject of the answers: "canonical" (default) keeps the target's, "rewrite" moves it into the queried domain
+	Subject string `json:"subject,omitempty" yaml:"subject"`
+}
+
+// domainAlias is a validated DomainAlias.
+type domainAlias struct {
+	domain  string
+	target  string
+	rewrite bool
+}
+
+// newDomainAliases validates the domain aliases: every alias must point at a configured domain, without
+// chaining through other aliases or shadowing a configured domain.
+func newDomainAliases(aliases []DomainAlias, domains []string) ([]domainAlias, error) {
+	compiled := make([]domainAlias, 0, len(aliases))
+	aliased := make([]string, 0, len(aliases))
+
+	for _, alias := range aliases {
+		aliased = append(aliased, alias.Domain)
+	}
+
+	for i, alias := range aliases {
+		switch {
+		case alias.Domain == "" || alias.Target == "":
+			return nil, fmt.Errorf("%w: alias %d: domain and target are required", ErrInvalidDomainAlias, i)
+		case strings.Contains(alias.Domain+alias.Target, "*"):
+			return nil, fmt.Errorf("%w: %s -> %s, wildcards can't be aliased", ErrInvalidDomainAlias, alias.Domain, alias.Target)
+		case isConfiguredDomain(alias.Domain, domains) || isServedHost(alias.Domain, domains):
+			return nil, fmt.Errorf("%w: %s is already a configured domain", ErrInvalidDomainAlias, alias.Domain)
+		case isConfiguredDomain(alias.Domain, aliased[:i]):
+			return nil, fmt.Errorf("%w: %s is aliased more than once", ErrInvalidDomainAlias, alias.Domain)
+		case strings.EqualFold(alias.Domain, alias.Target) || isConfiguredDomain(alias.Target, aliased):
+			return nil, fmt.Errorf("%w: %s -> %s loops through domain aliases", ErrInvalidDomainAlias, alias.Domain, alias.Target)
+		case !isConfiguredDomain(alias.Target, domains):
+			return nil, fmt.Errorf("%w: target %s is not configured", ErrInvalidDomainAlias, alias.Target)
+		}
+
+		if _, ok := parseAuthority(alias.Domain, ""); !ok {
+			return nil, fmt.Errorf("%w: domain %q", ErrInvalidDomainAlias, alias.Domain)
+		}
+
+		switch alias.Subject {
+		case "", aliasSubjectCanonical, aliasSubjectRewrite:
+		default:
+			return nil, fmt.Errorf("%w: %s: subject mode %q", ErrInvalidDomainAlias, alias.Domain, alias.Subject)
+		}
+
+		compiled = append(compiled, domainAlias{
+			domain:  alias.Domain,
+			target:  alias.Target,
+			rewrite: alias.Subject == aliasSubjectRewrite,
+		})
+	}
+
+	return compiled, nil
+}
+
+// matchDomainAlias returns the domain alias the resource belongs to.
+func (w *WebFinger) matchDomainAlias(resource string) (domainAlias, bool) {
+	for _, alias := range w.domainAliases {
+		if isResourceForDomain(resource, alias.domain) {
+			return alias, true
+		}
+	}
+
+	return domainAlias{}, false
+}
+
+// isAliasedDomain reports whether the domain is one of the domain aliases.
+func (w *WebFinger) isAliasedDomain(domain string) bool {
+	for _, alias := range w.domainAliases {
+		if strings.EqualFold(domain, alias.domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonical returns the resource of the target domain the aliased resource stands for.
+func (a domainAlias) canonical(resource string) string {
+	return replaceResourceHost(resource, a.target)
+}
+
+// localize moves the subject and the aliases of the target domain into the aliased domain, in rewrite mode.
+func (a domainAlias) localize(response WebFingerResponse) WebFingerResponse {
+	if !a.rewrite {
+		return response
+	}
+
+	if isResourceForDomain(response.Subject, a.target) {
+		response.Subject = replaceResourceHost(response.Subject, a.domain)
+	}
+
+	aliases := make([]string, 0, len(response.Aliases))
+
+	for _, alias := range response.Aliases {
+		if isResourceForDomain(alias, a.target) {
+			alias = replaceResourceHost(alias, a.domain)
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	if len(aliases) > 0 {
+		response.Aliases = aliases
+	}
+
+	return response
+}
+
+// replaceResourceHost replaces the host and port a resource URI refers to, keeping everything else as is:
+// the part after the last "@" of opaque URIs such as acct:, or the authority of hierarchical URIs.
+func replaceResourceHost(resource, host string) string {
+	parsed, err := url.Parse(resource)
+	if err != nil || parsed.Scheme == "" {
+		return resource
+	}
+
+	rest := resource[len(parsed.Scheme)+1:]
+
+	if parsed.Opaque != "" {
+		at := strings.LastIndex(parsed.Opaque, "@")
+		if at < 0 {
+			return resource
+		}
+
+		return resource[:len(parsed.Scheme)+1] + parsed.Opaque[:at+1] + host + rest[len(parsed.Opaque):]
+	}
+
+	if !strings.HasPrefix(rest, "//") {
+		return resource
+	}
+
+	rest = rest[2:]
+
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+
+	userinfo := ""
+	if at := strings.LastIndex(rest[:end], "@"); at >= 0 {
+		userinfo = rest[:at+1]
+	}
+
+	return resource[:len(parsed.Scheme)+3] + userinfo + host + rest[end:]
+}
@@ -0,0 +1,165 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainAliases(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.DomainAliases = []traefik_webfinger.DomainAlias{
+		{Domain: "example.co.uk", Target: "example.com"},
+		{Domain: "ex.ample", Target: "example.com", Subject: "rewrite"},
+	}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Aliases: []string{"https://example.com/@alice", "https://social.example.net/users/alice"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/@alice"},
+			},
+		},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		resource        string
+		expectedCode    int
+		expectedSubject string
+		expectedAliases []string
+	}{
+		{
+			name:            "Canonical subject",
+			resource:        "acct:alice@example.co.uk",
+			expectedCode:    http.StatusOK,
+			expectedSubject: "acct:alice@example.com",
+			expectedAliases: []string{"https://example.com/@alice", "https://social.example.net/users/alice"},
+		},
+		{
+			name:            "Canonical subject by URL alias",
+			resource:        "https://EXAMPLE.co.uk/@alice",
+			expectedCode:    http.StatusOK,
+			expectedSubject: "acct:alice@example.com",
+			expectedAliases: []string{"https://example.com/@alice", "https://social.example.net/users/alice"},
+		},
+		{
+			name:            "Rewritten subject",
+			resource:        "acct:alice@ex.ample",
+			expectedCode:    http.StatusOK,
+			expectedSubject: "acct:alice@ex.ample",
+			expectedAliases: []string{"https://ex.ample/@alice", "https://social.example.net/users/alice"},
+		},
+		{
+			name:         "Unknown user of an aliased domain",
+			resource:     "acct:bob@example.co.uk",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Domain that is not aliased",
+			resource:     "acct:alice@example.org",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := getResource(handler, tt.resource)
+			require.Equal(t, tt.expectedCode, recorder.Code)
+
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var response traefik_webfinger.WebFingerResponse
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+			assert.Equal(t, tt.expectedSubject, response.Subject)
+			assert.Equal(t, tt.expectedAliases, response.Aliases)
+			assert.Equal(t, "https://example.com/@alice", response.Links[0].Href)
+		})
+	}
+
+	// The stored record is not modified by rewriting
+	getResource(handler, "acct:alice@ex.ample")
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(getResource(handler, "acct:alice@example.com").Body).Decode(&response))
+	assert.Equal(t, "https://example.com/@alice", response.Aliases[0])
+}
+
+func TestDomainAliasHostBinding(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.HostBinding = true
+	cfg.DomainAliases = []traefik_webfinger.DomainAlias{{Domain: "example.co.uk", Target: "example.com"}}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	for host, expectedCode := range map[string]int{"example.co.uk": http.StatusOK, "example.com": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.co.uk", nil)
+		req.Host = host
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, expectedCode, recorder.Code, host)
+	}
+}
+
+func TestDomainAliasValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases []traefik_webfinger.DomainAlias
+	}{
+		{name: "Missing target", aliases: []traefik_webfinger.DomainAlias{{Domain: "example.co.uk"}}},
+		{name: "Overlap with a configured domain", aliases: []traefik_webfinger.DomainAlias{{Domain: "example.org", Target: "example.com"}}},
+		{name: "Alias of itself", aliases: []traefik_webfinger.DomainAlias{{Domain: "ex.ample", Target: "EX.ample"}}},
+		{
+			name: "Loop between aliases",
+			aliases: []traefik_webfinger.DomainAlias{
+				{Domain: "example.co.uk", Target: "ex.ample"},
+				{Domain: "ex.ample", Target: "example.co.uk"},
+			},
+		},
+		{
+			name: "Chain of aliases",
+			aliases: []traefik_webfinger.DomainAlias{
+				{Domain: "example.co.uk", Target: "example.com"},
+				{Domain: "ex.ample", Target: "example.co.uk"},
+			},
+		},
+		{
+			name: "Duplicate alias",
+			aliases: []traefik_webfinger.DomainAlias{
+				{Domain: "example.co.uk", Target: "example.com"},
+				{Domain: "Example.co.uk", Target: "example.org"},
+			},
+		},
+		{name: "Unknown target", aliases: []traefik_webfinger.DomainAlias{{Domain: "example.co.uk", Target: "example.net"}}},
+		{name: "Invalid subject mode", aliases: []traefik_webfinger.DomainAlias{{Domain: "example.co.uk", Target: "example.com", Subject: "keep"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domains = []string{"example.com", "example.org"}
+			cfg.DomainAliases = tt.aliases
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidDomainAlias)
+		})
+	}
+}
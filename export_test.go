@@ -0,0 +1,16 @@
+package traefik_webfinger
+
+import (
+	"net/http"
+	"time"
+)
+
+// IsResourceForDomain exposes isResourceForDomain to the external test package.
+var IsResourceForDomain = isResourceForDomain
+
+// SetClock replaces the clock of a handler created by New.
+func SetClock(handler http.Handler, clock func() time.Time) {
+	if webfinger, ok := handler.(*WebFinger); ok {
+		webfinger.clock = clock
+	}
+}
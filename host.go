@@ -0,0 +1,73 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Host mismatch behaviors of host binding.
+const (
+	hostMismatchNotFound    = "notfound"
+	hostMismatchPassthrough = "passthrough"
+)
+
+// validateHostMismatch checks the host mismatch behavior.
+func validateHostMismatch(mode string) error {
+	switch mode {
+	case "", hostMismatchNotFound, hostMismatchPassthrough:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidHostMismatch, mode)
+	}
+}
+
+// requestAuthority returns the host and optional port the client sent the request to, trusting forwarding headers
+// only from trusted proxies.
+func (w *WebFinger) requestAuthority(req *http.Request) string {
+	if w.trustedProxies.trusts(req) {
+		if forwarded := forwardedValue(req.Header.Get("Forwarded"), "host"); forwarded != "" {
+			return forwarded
+		}
+
+		if forwarded := lastListValue(req.Header.Get("X-Forwarded-Host")); forwarded != "" {
+			return forwarded
+		}
+	}
+
+	return req.Host
+}
+
+// requestHost returns the host name the client sent the request to, without port.
+func (w *WebFinger) requestHost(req *http.Request) string {
+	host := w.requestAuthority(req)
+
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// servesHost reports whether the request host is a configured domain, and, if a resource is given, whether the
+// resource belongs to that domain.
+func (w *WebFinger) servesHost(req *http.Request, resource string) bool {
+	host := w.requestHost(req)
+	if !isServedHost(host, w.domains) && !w.isAliasedDomain(host) {
+		return false
+	}
+
+	return resource == "" || isResourceForDomain(resource, host)
+}
+
+// rejectHost answers requests whose host does not serve the resource when host binding is enabled.
+func (w *WebFinger) rejectHost(responseWriter http.ResponseWriter, req *http.Request) {
+	if w.hostMismatch == hostMismatchPassthrough {
+		w.passToBackend(responseWriter, req)
+		return
+	}
+
+	w.cors.setHeaders(responseWriter.Header(), req)
+	http.Error(responseWriter, "Resource not found", http.StatusNotFound)
+}
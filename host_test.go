@@ -0,0 +1,131 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostBinding(t *testing.T) {
+	tests := []struct {
+		name         string
+		host         string
+		remoteAddr   string
+		headers      map[string]string
+		resource     string
+		expectedCode int
+	}{
+		{name: "Matching host", host: "example.com", resource: "acct:alice@example.com", expectedCode: http.StatusOK},
+		{name: "Matching host with port", host: "EXAMPLE.org:443", resource: "acct:bob@example.org", expectedCode: http.StatusOK},
+		{name: "Other configured domain", host: "example.org", resource: "acct:alice@example.com", expectedCode: http.StatusNotFound},
+		{name: "Unknown host", host: "other.example.net", resource: "acct:alice@example.com", expectedCode: http.StatusNotFound},
+		{
+			name:         "Forwarded host from trusted proxy",
+			host:         "internal:8080",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"X-Forwarded-Host": "example.com"},
+			resource:     "acct:alice@example.com",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Forwarded host from untrusted peer",
+			host:         "other.example.net",
+			remoteAddr:   "203.0.113.7:4711",
+			headers:      map[string]string{"Forwarded": "host=example.com"},
+			resource:     "acct:alice@example.com",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domains = []string{"example.com", "example.org"}
+	cfg.HostBinding = true
+	cfg.TrustedProxies = []string{"10.0.0.1"}
+	cfg.HostMeta.Enabled = true
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+		"acct:bob@example.org":   {Subject: "acct:bob@example.org"},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+tt.resource, nil)
+			req.Host = tt.host
+
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.expectedCode, recorder.Code)
+		})
+	}
+}
+
+func TestHostBindingPassthrough(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domains = []string{"example.com", "example.org"}
+	cfg.HostBinding = true
+	cfg.HostMismatch = "passthrough"
+	cfg.TrustedProxies = []string{"10.0.0.1"}
+	cfg.HostMeta.Enabled = true
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+		"acct:bob@example.org":   {Subject: "acct:bob@example.org"},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Host = "other.example.net"
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+
+	// Host-meta is bound to the host too
+	req = httptest.NewRequest(http.MethodGet, "/.well-known/host-meta", nil)
+	req.Host = "other.example.net"
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/.well-known/host-meta", nil)
+	req.Host = "example.org"
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "https://example.org/.well-known/webfinger")
+
+	// The mismatch behavior is validated
+	cfg = traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.HostMismatch = "ignore"
+
+	_, err = traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidHostMismatch)
+}
@@ -0,0 +1,97 @@
+package traefik_webfinger
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	hostMetaPath     = "/.well-known/host-meta"
+	hostMetaJSONPath = "/.well-known/host-meta.json"
+	lrddRel          = "lrdd"
+)
+
+// HostMetaConfig defines the host-meta documents (RFC 6415) served alongside WebFinger.
+type HostMetaConfig struct {
+	// Whether to answer /.well-known/host-meta and /.well-known/host-meta.json
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled"`
+	// Additional host-level links
+	Links []WebFingerLink `json:"links,omitempty" yaml:"links"`
+}
+
+// hostMetaDocument is the JRD form of a host-meta document.
+type hostMetaDocument struct {
+	Links []jrdLink `json:"links"`
+}
+
+// newHostMetaLinks checks the host-level links and parses their validity windows.
+func newHostMetaLinks(config HostMetaConfig) (resourceEntry, error) {
+	if err := validateLinks(hostMetaPath, config.Links); err != nil {
+		return resourceEntry{}, err
+	}
+
+	return newResourceEntry(hostMetaPath, WebFingerResponse{Links: config.Links})
+}
+
+// serveHostMeta answers host-meta requests with an LRDD template pointing at the WebFinger endpoint, followed by the
+// host-level links inside their validity window.
+func (w *WebFinger) serveHostMeta(responseWriter http.ResponseWriter, req *http.Request) {
+	lrdd := WebFingerLink{
+		Rel:      lrddRel,
+		Type:     "application/jrd+json",
+		Template: "https://" + w.hostMetaDomain(req) + webfingerPath + "?resource={uri}",
+	}
+
+	now := w.clock()
+	links, changes := w.hostMetaLinks.activeLinks(now)
+
+	w.cors.setHeaders(responseWriter.Header(), req)
+	setCacheHeaders(responseWriter.Header(), now, changes)
+
+	if req.URL.Path == hostMetaJSONPath {
+		document := hostMetaDocument{Links: newJRDLinks(append([]WebFingerLink{lrdd}, links...))}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(responseWriter).Encode(document); err != nil {
+			http.Error(responseWriter, "Error encoding response", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	document := xrdDocument{Links: []xrdLink{newXRDLink(lrdd)}}
+	for _, link := range links {
+		document.Links = append(document.Links, newXRDLink(link))
+	}
+
+	document.declareXSI()
+	writeXRD(responseWriter, document, http.StatusOK)
+}
+
+// hostMetaDomain returns the configured domain or wildcard subdomain the request was sent to, or else the first
+// configured domain that is not a wildcard.
+func (w *WebFinger) hostMetaDomain(req *http.Request) string {
+	host := w.requestHost(req)
+
+	for _, domain := range w.domains {
+		if strings.EqualFold(domain, host) {
+			return domain
+		}
+	}
+
+	// Subdomains matched by a wildcard domain are their own WebFinger hosts
+	if isServedHost(host, w.domains) {
+		return host
+	}
+
+	for _, domain := range w.domains {
+		if !isWildcardDomain(domain) {
+			return domain
+		}
+	}
+
+	return host
+}
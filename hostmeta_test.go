@@ -0,0 +1,164 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostMeta(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.HostMeta = traefik_webfinger.HostMetaConfig{
+		Enabled: true,
+		Links: []traefik_webfinger.WebFingerLink{
+			{Rel: "http://openid.net/specs/connect/1.0/issuer", Href: "https://auth.example.com"},
+		},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// XRD document
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/host-meta", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/xrd+xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, recorder.Body.String(), `<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">`)
+	assert.Contains(t, recorder.Body.String(),
+		`<Link rel="lrdd" type="application/jrd+json" template="https://example.com/.well-known/webfinger?resource={uri}"></Link>`)
+	assert.Contains(t, recorder.Body.String(),
+		`<Link rel="http://openid.net/specs/connect/1.0/issuer" href="https://auth.example.com"></Link>`)
+
+	// JRD document
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/host-meta.json", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var document struct {
+		Links []map[string]string `json:"links"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&document))
+	require.Len(t, document.Links, 2)
+	assert.Equal(t, map[string]string{
+		"rel":      "lrdd",
+		"type":     "application/jrd+json",
+		"template": "https://example.com/.well-known/webfinger?resource={uri}",
+	}, document.Links[0])
+	assert.Equal(t, "https://auth.example.com", document.Links[1]["href"])
+
+	// Only GET is served
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/.well-known/host-meta", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestHostMetaDomain(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Domains = []string{"example.org"}
+	cfg.HostMeta.Enabled = true
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{host: "example.org", expected: "https://example.org/.well-known/webfinger?resource={uri}"},
+		{host: "EXAMPLE.org:8443", expected: "https://example.org/.well-known/webfinger?resource={uri}"},
+		{host: "unknown.example.net", expected: "https://example.com/.well-known/webfinger?resource={uri}"},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/host-meta.json", nil)
+		req.Host = tt.host
+
+		handler.ServeHTTP(recorder, req)
+		assert.Contains(t, recorder.Body.String(), `"template":"`+tt.expected+`"`, tt.host)
+	}
+}
+
+func TestHostMetaDisabled(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	for _, path := range []string{"/.well-known/host-meta", "/.well-known/host-meta.json"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusTeapot, recorder.Code, path)
+	}
+
+	// Host-level links are validated
+	cfg.HostMeta.Links = []traefik_webfinger.WebFingerLink{{Href: "https://auth.example.com"}}
+	_, err = traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrRelRequired)
+}
+
+func TestHostMetaLinkWindows(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.HostMeta = traefik_webfinger.HostMetaConfig{
+		Enabled: true,
+		Links: []traefik_webfinger.WebFingerLink{
+			{Rel: "http://openid.net/specs/connect/1.0/issuer", Href: "https://auth.example.com", NotAfter: "2030-03-01"},
+		},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	clock := &fakeClock{now: time.Date(2030, 2, 28, 23, 0, 0, 0, time.UTC)}
+	traefik_webfinger.SetClock(handler, clock.Now)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "notAfter")
+
+		return recorder
+	}
+
+	// The window is applied and stripped, and caching is bounded by its end
+	for _, path := range []string{"/.well-known/host-meta", "/.well-known/host-meta.json"} {
+		recorder := get(path)
+		assert.Contains(t, recorder.Body.String(), "https://auth.example.com", path)
+		assert.Equal(t, "max-age=3600", recorder.Header().Get("Cache-Control"), path)
+	}
+
+	clock.now = time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, path := range []string{"/.well-known/host-meta", "/.well-known/host-meta.json"} {
+		recorder := get(path)
+		assert.NotContains(t, recorder.Body.String(), "https://auth.example.com", path)
+		assert.Contains(t, recorder.Body.String(), "lrdd", path)
+		assert.Empty(t, recorder.Header().Get("Cache-Control"), path)
+	}
+}
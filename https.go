@@ -0,0 +1,159 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HTTPS enforcement modes.
+const (
+	enforceHTTPSRedirect = "redirect"
+	enforceHTTPSReject   = "reject"
+)
+
+// trustedProxies is the set of peers whose forwarding headers are trusted.
+type trustedProxies []*net.IPNet
+
+// newTrustedProxies parses a list of IP addresses and CIDR ranges.
+func newTrustedProxies(entries []string) (trustedProxies, error) {
+	proxies := make(trustedProxies, 0, len(entries))
+
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidTrustedProxy, entry)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTrustedProxy, entry)
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// trusts reports whether the request comes directly from a trusted proxy.
+func (p trustedProxies) trusts(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedValue returns a parameter of the last element of a Forwarded header (RFC 7239), which is the one added
+// by the closest proxy.
+func forwardedValue(header, name string) string {
+	elements := strings.Split(header, ",")
+
+	for _, pair := range strings.Split(elements[len(elements)-1], ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(key, name) {
+			return strings.Trim(value, `"`)
+		}
+	}
+
+	return ""
+}
+
+// lastListValue returns the last entry of a comma-separated header such as X-Forwarded-Proto.
+func lastListValue(header string) string {
+	values := strings.Split(header, ",")
+
+	return strings.TrimSpace(values[len(values)-1])
+}
+
+// validateEnforceHTTPS checks the HTTPS enforcement mode.
+func validateEnforceHTTPS(mode string) error {
+	switch mode {
+	case "", enforceHTTPSRedirect, enforceHTTPSReject:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidEnforceHTTPS, mode)
+	}
+}
+
+// requestScheme returns the scheme the client used, trusting forwarding headers only from trusted proxies.
+func (w *WebFinger) requestScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+
+	if w.trustedProxies.trusts(req) {
+		if proto := forwardedValue(req.Header.Get("Forwarded"), "proto"); proto != "" {
+			return strings.ToLower(proto)
+		}
+
+		if proto := lastListValue(req.Header.Get("X-Forwarded-Proto")); proto != "" {
+			return strings.ToLower(proto)
+		}
+	}
+
+	return "http"
+}
+
+// httpsURL returns the HTTPS URL of the request, keeping any port other than the default HTTP one. Requests sent to
+// a host that is neither a configured domain nor a domain alias have no such URL, so that clients are never
+// redirected to a host taken from the request.
+func (w *WebFinger) httpsURL(req *http.Request) (string, bool) {
+	host := w.requestHost(req)
+	if !isServedHost(host, w.domains) && !w.isAliasedDomain(host) {
+		return "", false
+	}
+
+	if _, port, err := net.SplitHostPort(w.requestAuthority(req)); err == nil && port != "" && port != "80" {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+
+	return "https://" + host + req.URL.RequestURI(), true
+}
+
+// requireHTTPS redirects or rejects plain HTTP requests when HTTPS is enforced, and reports whether the request
+// may be served. Requests that cannot be redirected to a configured domain are rejected.
+func (w *WebFinger) requireHTTPS(responseWriter http.ResponseWriter, req *http.Request) bool {
+	if w.enforceHTTPS == "" || w.requestScheme(req) == "https" {
+		return true
+	}
+
+	w.cors.setHeaders(responseWriter.Header(), req)
+
+	if w.enforceHTTPS == enforceHTTPSRedirect {
+		if target, ok := w.httpsURL(req); ok {
+			http.Redirect(responseWriter, req, target, http.StatusMovedPermanently)
+
+			return false
+		}
+	}
+
+	http.Error(responseWriter, "WebFinger requires HTTPS", http.StatusForbidden)
+
+	return false
+}
@@ -0,0 +1,194 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnforceHTTPS(t *testing.T) {
+	const (
+		query    = "/.well-known/webfinger?resource=acct:alice@example.com"
+		location = "https://example.com" + query
+	)
+
+	tests := []struct {
+		name         string
+		method       string
+		host         string
+		remoteAddr   string
+		tls          bool
+		headers      map[string]string
+		expectedCode int
+		location     string
+	}{
+		{name: "Direct TLS", remoteAddr: "203.0.113.7:4711", tls: true, expectedCode: http.StatusOK},
+		{name: "Plain HTTP", remoteAddr: "203.0.113.7:4711", expectedCode: http.StatusMovedPermanently, location: location},
+		{
+			name:         "X-Forwarded-Proto from trusted proxy",
+			remoteAddr:   "10.1.2.3:4711",
+			headers:      map[string]string{"X-Forwarded-Proto": "https"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Forwarded from trusted proxy",
+			remoteAddr:   "192.0.2.1:4711",
+			headers:      map[string]string{"Forwarded": `for=203.0.113.7;proto=http, for=198.51.100.1;proto="https"`},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Spoofed Forwarded element before the trusted one",
+			remoteAddr:   "192.0.2.1:4711",
+			headers:      map[string]string{"Forwarded": "proto=https, for=203.0.113.7;proto=http"},
+			expectedCode: http.StatusMovedPermanently,
+			location:     location,
+		},
+		{
+			name:         "X-Forwarded-Proto from untrusted peer",
+			remoteAddr:   "203.0.113.7:4711",
+			headers:      map[string]string{"X-Forwarded-Proto": "https"},
+			expectedCode: http.StatusMovedPermanently,
+			location:     location,
+		},
+		{
+			name:         "Forwarded from untrusted peer",
+			remoteAddr:   "192.0.2.2:4711",
+			headers:      map[string]string{"Forwarded": "proto=https"},
+			expectedCode: http.StatusMovedPermanently,
+			location:     location,
+		},
+		{
+			name:         "Non-default port is kept",
+			host:         "Example.com:8080",
+			remoteAddr:   "203.0.113.7:4711",
+			expectedCode: http.StatusMovedPermanently,
+			location:     "https://example.com:8080" + query,
+		},
+		{
+			name:         "Host forwarded by trusted proxy",
+			remoteAddr:   "10.1.2.3:4711",
+			headers:      map[string]string{"X-Forwarded-Host": "example.com:8443"},
+			expectedCode: http.StatusMovedPermanently,
+			location:     "https://example.com:8443" + query,
+		},
+		{
+			name:         "Domain alias",
+			host:         "example.org",
+			remoteAddr:   "203.0.113.7:4711",
+			expectedCode: http.StatusMovedPermanently,
+			location:     "https://example.org" + query,
+		},
+		{name: "Unknown host", host: "evil.example.net", remoteAddr: "203.0.113.7:4711", expectedCode: http.StatusForbidden},
+		{
+			name:         "Host forwarded by untrusted peer",
+			remoteAddr:   "203.0.113.7:4711",
+			headers:      map[string]string{"X-Forwarded-Host": "evil.example.net"},
+			expectedCode: http.StatusMovedPermanently,
+			location:     location,
+		},
+		{
+			name:         "CORS preflight",
+			method:       http.MethodOptions,
+			remoteAddr:   "203.0.113.7:4711",
+			headers:      map[string]string{"Origin": "https://app.example.net", "Access-Control-Request-Method": http.MethodGet},
+			expectedCode: http.StatusNoContent,
+		},
+	}
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.DomainAliases = []traefik_webfinger.DomainAlias{{Domain: "example.org", Target: "example.com"}}
+	cfg.EnforceHTTPS = "redirect"
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := httptest.NewRequest(method, "http://example.com:80"+query, nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.expectedCode, recorder.Code)
+			assert.Equal(t, tt.location, recorder.Header().Get("Location"))
+		})
+	}
+}
+
+func TestEnforceHTTPSModes(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		target       string
+		expectedCode int
+	}{
+		{name: "Rejected", mode: "reject", target: "/.well-known/webfinger?resource=acct:alice@example.com", expectedCode: http.StatusForbidden},
+		{name: "Served by default", target: "/.well-known/webfinger?resource=acct:alice@example.com", expectedCode: http.StatusOK},
+		{name: "Other paths are never affected", mode: "reject", target: "/about", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.EnforceHTTPS = tt.mode
+			cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+				"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+			}
+
+			handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			assert.Equal(t, tt.expectedCode, recorder.Code)
+
+			if tt.expectedCode == http.StatusForbidden {
+				assert.Contains(t, recorder.Body.String(), "HTTPS")
+			}
+		})
+	}
+}
+
+func TestEnforceHTTPSValidation(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.EnforceHTTPS = "always"
+
+	_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidEnforceHTTPS)
+
+	cfg.EnforceHTTPS = "reject"
+	cfg.TrustedProxies = []string{"10.0.0.0/33"}
+
+	_, err = traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidTrustedProxy)
+}
@@ -0,0 +1,48 @@
+package traefik_webfinger
+
+// jrdDocument is the JSON form of a resource descriptor (RFC 7033 section 4.4). Unlike WebFingerResponse, it only
+// has the members of the served document, so settings such as profiles or validity windows never reach clients.
+type jrdDocument struct {
+	Subject    string             `json:"subject"`
+	Aliases    []string           `json:"aliases,omitempty"`
+	Properties map[string]*string `json:"properties,omitempty"`
+	Links      []jrdLink          `json:"links,omitempty"`
+}
+
+// jrdLink is a link of a JRD document.
+type jrdLink struct {
+	Rel        string             `json:"rel"`
+	Type       string             `json:"type,omitempty"`
+	Href       string             `json:"href,omitempty"`
+	Template   string             `json:"template,omitempty"`
+	Titles     map[string]string  `json:"titles,omitempty"`
+	Properties map[string]*string `json:"properties,omitempty"`
+}
+
+// newJRDDocument converts a WebFinger response into the document served to clients.
+func newJRDDocument(response WebFingerResponse) jrdDocument {
+	return jrdDocument{
+		Subject:    response.Subject,
+		Aliases:    response.Aliases,
+		Properties: response.Properties,
+		Links:      newJRDLinks(response.Links),
+	}
+}
+
+// newJRDLinks converts links into their served form.
+func newJRDLinks(links []WebFingerLink) []jrdLink {
+	result := make([]jrdLink, 0, len(links))
+
+	for _, link := range links {
+		result = append(result, jrdLink{
+			Rel:        link.Rel,
+			Type:       link.Type,
+			Href:       link.Href,
+			Template:   link.Template,
+			Titles:     link.Titles,
+			Properties: link.Properties,
+		})
+	}
+
+	return result
+}
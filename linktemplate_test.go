@@ -0,0 +1,263 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const subscribeRel = "http://ostatus.org/schema/1.0/subscribe"
+
+func TestLinkTemplates(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Type: "application/activity+json", Href: "https://social.example.com/users/alice"},
+				{Rel: subscribeRel, Template: "https://social.example.com/authorize_interaction?uri={uri}"},
+			},
+		},
+	}
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@example.com": {
+			Subject: "acct:{user}@example.com",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: subscribeRel, Template: "https://social.example.com/{user}/follow?uri={uri}"},
+			},
+		},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := getResource(handler, "acct:alice@example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var document map[string]interface{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&document))
+
+	links, ok := document["links"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, links, 2)
+	assert.Equal(t, map[string]interface{}{
+		"rel":      subscribeRel,
+		"template": "https://social.example.com/authorize_interaction?uri={uri}",
+	}, links[1])
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Header.Set("Accept", "application/xrd+xml")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(),
+		`<Link rel="`+subscribeRel+`" template="https://social.example.com/authorize_interaction?uri={uri}"></Link>`)
+
+	// Resource template variables are replaced, other placeholders are left for the client
+	recorder = getResource(handler, "acct:bob@example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Links, 1)
+	assert.Equal(t, "https://social.example.com/bob/follow?uri={uri}", response.Links[0].Template)
+	assert.Empty(t, response.Links[0].Href)
+}
+
+func TestLinkTemplatesMergedFromBackend(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Merge.Enabled = true
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: subscribeRel, Template: "https://example.com/follow?uri={uri}"},
+			},
+		},
+	}
+	cfg.Rewrites = []traefik_webfinger.RewriteRule{{From: "http://mastodon-web:3000", To: "https://social.example.com"}}
+
+	backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/jrd+json")
+		_, err := io.WriteString(rw, `{
+			"subject": "acct:alice@example.com",
+			"links": [
+				{"rel": "`+subscribeRel+`", "template": "http://mastodon-web:3000/authorize_interaction?uri={uri}"}
+			]
+		}`)
+		require.NoError(t, err)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := getResource(handler, "acct:alice@example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+	// Links with different templates are distinct, and backend templates get the public origin
+	require.Len(t, response.Links, 2)
+	assert.Equal(t, "https://social.example.com/authorize_interaction?uri={uri}", response.Links[0].Template)
+	assert.Equal(t, "https://example.com/follow?uri={uri}", response.Links[1].Template)
+}
+
+func TestLinkTemplateValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		link traefik_webfinger.WebFingerLink
+	}{
+		{
+			name: "Both href and template",
+			link: traefik_webfinger.WebFingerLink{Rel: subscribeRel, Href: "https://example.com/follow", Template: "https://example.com/follow?uri={uri}"},
+		},
+		{
+			name: "Unterminated placeholder",
+			link: traefik_webfinger.WebFingerLink{Rel: subscribeRel, Template: "https://example.com/follow?uri={uri"},
+		},
+		{
+			name: "Unexpected closing brace",
+			link: traefik_webfinger.WebFingerLink{Rel: subscribeRel, Template: "https://example.com/follow?uri=uri}"},
+		},
+		{
+			name: "Empty placeholder",
+			link: traefik_webfinger.WebFingerLink{Rel: subscribeRel, Template: "https://example.com/follow?uri={}"},
+		},
+		{
+			name: "Malformed placeholder name",
+			link: traefik_webfinger.WebFingerLink{Rel: subscribeRel, Template: "https://example.com/follow?uri={the uri}"},
+		},
+		{
+			name: "Without placeholder",
+			link: traefik_webfinger.WebFingerLink{Rel: subscribeRel, Template: "https://example.com/follow"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+				"acct:alice@example.com": {Subject: "acct:alice@example.com", Links: []traefik_webfinger.WebFingerLink{tt.link}},
+			}
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidLinkTemplate)
+
+			cfg = traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.HostMeta = traefik_webfinger.HostMetaConfig{Enabled: true, Links: []traefik_webfinger.WebFingerLink{tt.link}}
+
+			_, err = traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidLinkTemplate)
+		})
+	}
+}
+
+func TestLinkTemplatesInResourceRules(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourceRules = []traefik_webfinger.ResourceRule{
+		{
+			Match: `urn:example:employee:(?P<id>[0-9]+)|urn:example:team:(?P<team>[a-z]+)`,
+			Response: traefik_webfinger.WebFingerResponse{
+				Subject: "urn:example:member",
+				Links: []traefik_webfinger.WebFingerLink{
+					{Rel: subscribeRel, Template: "https://intranet.example.com/people/{id}/follow?uri={uri}"},
+				},
+			},
+		},
+		{
+			Match: `urn:example:project:(?P<project>[a-z]+)`,
+			Response: traefik_webfinger.WebFingerResponse{
+				Subject: "urn:example:project:{project}",
+				Links: []traefik_webfinger.WebFingerLink{
+					{Rel: subscribeRel, Template: "https://intranet.example.com/p/{project}"},
+				},
+			},
+		},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := getResource(handler, "urn:example:employee:1234")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Links, 1)
+	assert.Equal(t, "https://intranet.example.com/people/1234/follow?uri={uri}", response.Links[0].Template)
+
+	// The group of the link template did not take part in the match
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "urn:example:team:ops"))
+
+	// A template whose only placeholders are rule groups is served once they are replaced
+	recorder = getResource(handler, "urn:example:project:apollo")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	response = traefik_webfinger.WebFingerResponse{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Links, 1)
+	assert.Equal(t, "https://intranet.example.com/p/apollo", response.Links[0].Template)
+}
+
+func TestLinkTemplatePlaceholderValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(cfg *traefik_webfinger.Config)
+		expectErr error
+	}{
+		{
+			name: "Subdomain not captured by the resource template",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.ResourceTemplates["acct:{user}@example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:{user}@example.com",
+					Links: []traefik_webfinger.WebFingerLink{
+						{Rel: subscribeRel, Template: "https://{subdomain}.example.com/follow?uri={uri}"},
+					},
+				}
+			},
+			expectErr: traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name: "Rule group replacing the client placeholder",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.ResourceRules = []traefik_webfinger.ResourceRule{
+					{
+						Match: `urn:example:(?P<uri>[a-z]+)`,
+						Response: traefik_webfinger.WebFingerResponse{
+							Subject: "urn:example:{uri}",
+							Links: []traefik_webfinger.WebFingerLink{
+								{Rel: subscribeRel, Template: "https://example.com/follow?uri={uri}"},
+							},
+						},
+					},
+				}
+			},
+			expectErr: traefik_webfinger.ErrInvalidResourceRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			tt.modify(cfg)
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, tt.expectErr)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package traefik_webfinger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+const (
+	precedenceBackend = "backend"
+	precedenceConfig  = "config"
+	// maxBackendBodySize bounds the backend documents buffered for merging
+	maxBackendBodySize = 1 << 20
+)
+
+// MergeConfig defines how configured resources enrich the JRD documents served by the backend.
+type MergeConfig struct {
+	// Whether configured resources are merged into the backend response instead of replacing it
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled"`
+	// Which side wins when both define the subject, the same link or the same property: backend (default) or config
+	Precedence string `json:"precedence,omitempty" yaml:"precedence"`
+}
+
+// validateMerge checks the merge precedence.
+func validateMerge(config MergeConfig) error {
+	switch config.Precedence {
+	case "", precedenceBackend, precedenceConfig:
+		return nil
+	default:
+		return fmt.Errorf("%w: precedence %q", ErrInvalidMerge, config.Precedence)
+	}
+}
+
+// bufferedResponse captures a response of the next handler so it can be inspected before being sent.
+type bufferedResponse struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+// newBufferedResponse creates an empty buffer.
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+// Header implements http.ResponseWriter.
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// Write implements http.ResponseWriter, discarding anything beyond the maximum body size.
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+
+	if b.body.Len()+len(data) > maxBackendBodySize {
+		b.overflow = true
+		return len(data), nil
+	}
+
+	return b.body.Write(data)
+}
+
+// jrd decodes the captured body if it is a complete, successful JRD document.
+func (b *bufferedResponse) jrd() (WebFingerResponse, bool) {
+	var response WebFingerResponse
+
+	if b.status != http.StatusOK || b.overflow {
+		return response, false
+	}
+
+	if !isJRDContentType(b.header.Get("Content-Type")) {
+		return response, false
+	}
+
+	if err := json.Unmarshal(b.body.Bytes(), &response); err != nil || response.Subject == "" {
+		return response, false
+	}
+
+	return response, true
+}
+
+// isJRDContentType reports whether the Content-Type header denotes a JRD document.
+func isJRDContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	return err == nil && (mediaType == "application/jrd+json" || mediaType == "application/json")
+}
+
+// fetchBackendJRD passes the request to the next handler and returns its JRD document, if it produced one.
+func (w *WebFinger) fetchBackendJRD(req *http.Request) (WebFingerResponse, bool) {
+	backendReq := req.Clone(req.Context())
+	backendReq.Header.Set("Accept", "application/jrd+json")
+	// The body has to be readable, so the backend must not compress it
+	backendReq.Header.Del("Accept-Encoding")
+
+	buffer := newBufferedResponse()
+	w.next.ServeHTTP(buffer, backendReq)
+
+	response, ok := buffer.jrd()
+
+	return rewriteResponse(w.rewrites, response), ok
+}
+
+// mergeResponses combines two documents. The primary document wins for the subject, and for the titles and
+// properties of links present in both, links being identified by rel and href.
+func mergeResponses(primary, secondary WebFingerResponse) WebFingerResponse {
+	merged := WebFingerResponse{
+		Subject:    primary.Subject,
+		Aliases:    make([]string, 0, len(primary.Aliases)+len(secondary.Aliases)),
+		Properties: mergeProperties(primary.Properties, secondary.Properties),
+		Links:      make([]WebFingerLink, 0, len(primary.Links)+len(secondary.Links)),
+	}
+
+	seenAliases := make(map[string]struct{}, cap(merged.Aliases))
+
+	for _, alias := range append(append([]string{}, primary.Aliases...), secondary.Aliases...) {
+		if _, ok := seenAliases[alias]; !ok && alias != merged.Subject {
+			seenAliases[alias] = struct{}{}
+			merged.Aliases = append(merged.Aliases, alias)
+		}
+	}
+
+	positions := make(map[string]int, cap(merged.Links))
+
+	for _, link := range append(append([]WebFingerLink{}, primary.Links...), secondary.Links...) {
+		key := link.Rel + "\x00" + link.Href + "\x00" + link.Template
+
+		position, ok := positions[key]
+		if !ok {
+			positions[key] = len(merged.Links)
+			merged.Links = append(merged.Links, link)
+
+			continue
+		}
+
+		existing := &merged.Links[position]
+		existing.Titles = mergeStrings(existing.Titles, link.Titles)
+		existing.Properties = mergeProperties(existing.Properties, link.Properties)
+
+		if existing.Type == "" {
+			existing.Type = link.Type
+		}
+	}
+
+	return merged
+}
+
+// mergeProperties returns a new map with the properties of both maps, the primary map winning on conflicts, null
+// values included.
+func mergeProperties(primary, secondary map[string]*string) map[string]*string {
+	if len(secondary) == 0 {
+		return primary
+	}
+
+	merged := make(map[string]*string, len(primary)+len(secondary))
+
+	for name, value := range secondary {
+		merged[name] = value
+	}
+
+	for name, value := range primary {
+		merged[name] = value
+	}
+
+	return merged
+}
+
+// mergeStrings returns a new map with the entries of both maps, the primary map winning on conflicts.
+func mergeStrings(primary, secondary map[string]string) map[string]string {
+	if len(secondary) == 0 {
+		return primary
+	}
+
+	merged := make(map[string]string, len(primary)+len(secondary))
+
+	for key, value := range secondary {
+		merged[key] = value
+	}
+
+	for key, value := range primary {
+		merged[key] = value
+	}
+
+	return merged
+}
@@ -0,0 +1,180 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePrecedence(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Merge.Enabled = true
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Aliases: []string{"https://example.com/alice", "https://social.example.com/@alice"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://openid.net/specs/connect/1.0/issuer", Href: "https://auth.example.com"},
+				{
+					Rel:        "self",
+					Type:       "application/activity+json",
+					Href:       "https://social.example.com/users/alice",
+					Properties: propertyMap(map[string]string{"http://example.com/ns/source": "config", "http://example.com/ns/team": "web"}),
+				},
+			},
+		},
+	}
+
+	backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "application/jrd+json", req.Header.Get("Accept"))
+		assert.Empty(t, req.Header.Get("Accept-Encoding"))
+
+		rw.Header().Set("Content-Type", "application/jrd+json; charset=utf-8")
+		_, err := io.WriteString(rw, `{
+			"subject": "acct:alice@social.example.com",
+			"aliases": ["https://social.example.com/@alice"],
+			"links": [
+				{"rel": "self", "type": "application/activity+json", "href": "https://social.example.com/users/alice",
+				 "properties": {"http://example.com/ns/source": "backend"}},
+				{"rel": "http://ostatus.org/schema/1.0/subscribe", "href": "https://social.example.com/follow"}
+			]
+		}`)
+		require.NoError(t, err)
+	})
+
+	t.Run("Backend", func(t *testing.T) {
+		handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var response traefik_webfinger.WebFingerResponse
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+		assert.Equal(t, "acct:alice@social.example.com", response.Subject)
+		assert.Equal(t, []string{"https://social.example.com/@alice", "https://example.com/alice"}, response.Aliases)
+		require.Len(t, response.Links, 3)
+		assert.Equal(t, "self", response.Links[0].Rel)
+		assert.Equal(t, propertyMap(map[string]string{
+			"http://example.com/ns/source": "backend",
+			"http://example.com/ns/team":   "web",
+		}), response.Links[0].Properties)
+		assert.Equal(t, "http://ostatus.org/schema/1.0/subscribe", response.Links[1].Rel)
+		assert.Equal(t, "http://openid.net/specs/connect/1.0/issuer", response.Links[2].Rel)
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		cfg.Merge.Precedence = "config"
+
+		handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+		require.NoError(t, err)
+
+		recorder := getResource(handler, "acct:alice@example.com")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var response traefik_webfinger.WebFingerResponse
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+		assert.Equal(t, "acct:alice@example.com", response.Subject)
+		require.Len(t, response.Links, 3)
+		assert.Equal(t, "http://openid.net/specs/connect/1.0/issuer", response.Links[0].Rel)
+		assert.Equal(t, "config", *response.Links[1].Properties["http://example.com/ns/source"])
+	})
+}
+
+func TestMergeWithoutBackendDocument(t *testing.T) {
+	for name, backend := range map[string]http.HandlerFunc{
+		"Not found": func(rw http.ResponseWriter, req *http.Request) {
+			http.NotFound(rw, req)
+		},
+		"Not JRD": func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Content-Type", "text/html")
+			_, _ = io.WriteString(rw, "<html></html>")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.Merge.Enabled = true
+			cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+				"acct:alice@example.com": {
+					Subject: "acct:alice@example.com",
+					Links: []traefik_webfinger.WebFingerLink{
+						{Rel: "http://openid.net/specs/connect/1.0/issuer", Href: "https://auth.example.com"},
+						{Rel: "self", Type: "application/activity+json", Href: "https://social.example.com/users/alice"},
+					},
+				},
+			}
+
+			handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+			require.NoError(t, err)
+
+			recorder := getResource(handler, "acct:alice@example.com")
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var response traefik_webfinger.WebFingerResponse
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+			assert.Equal(t, "acct:alice@example.com", response.Subject)
+			assert.Len(t, response.Links, 2)
+		})
+	}
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Merge.Precedence = "both"
+
+	_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidMerge)
+}
+
+func TestMergeRewrittenBackendProperties(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Merge.Enabled = true
+	cfg.Rewrites = []traefik_webfinger.RewriteRule{{From: "http://mastodon-web:3000", To: "https://social.example.com"}}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject:    "acct:alice@example.com",
+			Properties: propertyMap(map[string]string{"http://example.com/ns/team": "web"}),
+		},
+	}
+
+	backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/jrd+json")
+		_, err := io.WriteString(rw, `{
+			"subject": "acct:alice@mastodon-web:3000",
+			"properties": {"http://example.com/ns/kind": "person", "http://example.com/ns/phone": null},
+			"links": [{"rel": "self", "href": "http://mastodon-web:3000/users/alice"}]
+		}`)
+		require.NoError(t, err)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := getResource(handler, "acct:alice@example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var document map[string]interface{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&document))
+
+	assert.Equal(t, "acct:alice@social.example.com", document["subject"])
+	assert.Equal(t, map[string]interface{}{
+		"http://example.com/ns/kind":  "person",
+		"http://example.com/ns/phone": nil,
+		"http://example.com/ns/team":  "web",
+	}, document["properties"])
+}
@@ -0,0 +1,124 @@
+package traefik_webfinger
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mediaFormat is a document format the middleware can produce.
+type mediaFormat int
+
+const (
+	formatJRD mediaFormat = iota
+	formatXRD
+)
+
+// Media type specificity, used to pick the most specific Accept range for an offer.
+const (
+	matchAny = iota
+	matchSubtype
+	matchExact
+)
+
+// mediaOffer is a media type the middleware can answer with.
+type mediaOffer struct {
+	mediaType string
+	format    mediaFormat
+}
+
+// webfingerOffers lists the producible media types, in order of server preference.
+var webfingerOffers = []mediaOffer{
+	{mediaType: "application/jrd+json", format: formatJRD},
+	{mediaType: "application/json", format: formatJRD},
+	{mediaType: "application/xrd+xml", format: formatXRD},
+}
+
+// acceptRange is a parsed media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// negotiateFormat picks the format preferred by the Accept header, reporting false when nothing acceptable can be produced.
+func negotiateFormat(accept string) (mediaFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formatJRD, true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQuality := formatJRD, 0.0
+
+	for _, offer := range webfingerOffers {
+		// Ties are resolved in favor of the earlier offer
+		if quality := offerQuality(offer.mediaType, ranges); quality > bestQuality {
+			best, bestQuality = offer.format, quality
+		}
+	}
+
+	return best, bestQuality > 0
+}
+
+// parseAccept splits an Accept header into media ranges with their q-values (RFC 9110 section 12.5.1).
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+
+		mediaRange := acceptRange{
+			mediaType: strings.ToLower(strings.TrimSpace(params[0])),
+			quality:   1,
+		}
+		if mediaRange.mediaType == "" {
+			continue
+		}
+
+		valid := true
+
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+
+			quality, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || quality < 0 || quality > 1 {
+				valid = false
+				break
+			}
+
+			mediaRange.quality = quality
+		}
+
+		if valid {
+			ranges = append(ranges, mediaRange)
+		}
+	}
+
+	return ranges
+}
+
+// offerQuality returns the q-value of the most specific range matching the media type, or 0 if none matches.
+func offerQuality(mediaType string, ranges []acceptRange) float64 {
+	quality, specificity := 0.0, -1
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	for _, mediaRange := range ranges {
+		match := -1
+
+		switch mediaRange.mediaType {
+		case mediaType:
+			match = matchExact
+		case mainType + "/*":
+			match = matchSubtype
+		case "*/*":
+			match = matchAny
+		}
+
+		if match > specificity {
+			quality, specificity = mediaRange.quality, match
+		}
+	}
+
+	return quality
+}
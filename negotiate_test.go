@@ -0,0 +1,103 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentNegotiation(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Aliases: []string{"https://example.com/alice"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{
+					Rel:        "http://webfinger.net/rel/profile-page",
+					Type:       "text/html",
+					Href:       "https://example.com/alice",
+					Titles:     map[string]string{"en": "Alice", "und": "Alice"},
+					Properties: propertyMap(map[string]string{"http://example.com/ns/role": "staff"}),
+				},
+			},
+		},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		accept       string
+		expectedCode int
+		expectedType string
+	}{
+		{name: "No Accept header", accept: "", expectedCode: http.StatusOK, expectedType: "application/jrd+json"},
+		{name: "Any", accept: "*/*", expectedCode: http.StatusOK, expectedType: "application/jrd+json"},
+		{name: "JRD", accept: "application/jrd+json", expectedCode: http.StatusOK, expectedType: "application/jrd+json"},
+		{name: "JSON", accept: "application/json", expectedCode: http.StatusOK, expectedType: "application/jrd+json"},
+		{name: "XRD", accept: "application/xrd+xml", expectedCode: http.StatusOK, expectedType: "application/xrd+xml; charset=utf-8"},
+		{
+			name:         "XRD preferred by q-value",
+			accept:       "application/jrd+json;q=0.5, application/xrd+xml",
+			expectedCode: http.StatusOK,
+			expectedType: "application/xrd+xml; charset=utf-8",
+		},
+		{
+			name:         "JRD preferred by q-value",
+			accept:       "application/xrd+xml;q=0.4, application/*;q=0.8",
+			expectedCode: http.StatusOK,
+			expectedType: "application/jrd+json",
+		},
+		{
+			name:         "Specific range overrides wildcard",
+			accept:       "application/jrd+json;q=0, application/json;q=0, */*",
+			expectedCode: http.StatusOK,
+			expectedType: "application/xrd+xml; charset=utf-8",
+		},
+		{name: "Unsupported type", accept: "text/html", expectedCode: http.StatusNotAcceptable},
+		{name: "Everything refused", accept: "*/*;q=0", expectedCode: http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.expectedCode, recorder.Code)
+			assert.Contains(t, recorder.Header().Values("Vary"), "Accept")
+
+			if tt.expectedType != "" {
+				assert.Equal(t, tt.expectedType, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// XRD document content
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Header.Set("Accept", "application/xrd+xml")
+
+	handler.ServeHTTP(recorder, req)
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `<Subject>acct:alice@example.com</Subject>`)
+	assert.Contains(t, body, `<Alias>https://example.com/alice</Alias>`)
+	assert.Contains(t, body, `<Link rel="http://webfinger.net/rel/profile-page" type="text/html" href="https://example.com/alice">`)
+	assert.Contains(t, body, `<Title xml:lang="en">Alice</Title>`)
+	assert.Contains(t, body, `<Title>Alice</Title>`)
+	assert.Contains(t, body, `<Property type="http://example.com/ns/role">staff</Property>`)
+}
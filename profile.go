@@ -0,0 +1,169 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LinkProfile is a named set of links and properties that resources reference by name.
+type LinkProfile struct {
+	// Profiles this profile extends, earlier ones taking precedence
+	Extends []string `json:"extends,omitempty" yaml:"extends"`
+	// Links of the profile
+	Links []WebFingerLink `json:"links,omitempty" yaml:"links"`
+	// Properties of the profile
+	Properties map[string]*string `json:"properties,omitempty" yaml:"properties"`
+}
+
+// linkProfile is a layer of links and properties added to a response.
+type linkProfile struct {
+	links      []WebFingerLink
+	properties map[string]*string
+}
+
+// linkProfiles holds the flattened profiles by name.
+type linkProfiles map[string]linkProfile
+
+// profileFlattener resolves the profiles extended by each profile, detecting cycles.
+type profileFlattener struct {
+	config    map[string]LinkProfile
+	flattened linkProfiles
+	visiting  map[string]bool
+}
+
+// newLinkProfiles validates the profiles and flattens the profiles they extend into them.
+func newLinkProfiles(config map[string]LinkProfile) (linkProfiles, error) {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	flattener := &profileFlattener{
+		config:    config,
+		flattened: make(linkProfiles, len(config)),
+		visiting:  make(map[string]bool, len(config)),
+	}
+
+	for _, name := range names {
+		if err := validateLinks("profile "+name, config[name].Links); err != nil {
+			return nil, err
+		}
+
+		if err := validateProperties("profile "+name, config[name].Properties); err != nil {
+			return nil, err
+		}
+
+		if _, err := flattener.flatten(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return flattener.flattened, nil
+}
+
+// flatten returns the profile with the profiles it extends overlaid in order.
+func (f *profileFlattener) flatten(name string, chain []string) (linkProfile, error) {
+	if profile, ok := f.flattened[name]; ok {
+		return profile, nil
+	}
+
+	chain = append(chain, name)
+
+	config, ok := f.config[name]
+	if !ok {
+		return linkProfile{}, fmt.Errorf("%w: %s, referenced by %s", ErrUnknownProfile, name, strings.Join(chain[:len(chain)-1], " -> "))
+	}
+
+	if f.visiting[name] {
+		return linkProfile{}, fmt.Errorf("%w: %s", ErrProfileCycle, strings.Join(chain, " -> "))
+	}
+
+	f.visiting[name] = true
+
+	profile := linkProfile{links: config.Links, properties: config.Properties}
+
+	for _, extended := range config.Extends {
+		parent, err := f.flatten(extended, chain)
+		if err != nil {
+			return linkProfile{}, err
+		}
+
+		profile = profile.overlay(parent, nil)
+	}
+
+	f.visiting[name] = false
+	f.flattened[name] = profile
+
+	return profile, nil
+}
+
+// validate checks that the response only references known profiles.
+func (p linkProfiles) validate(resource string, response WebFingerResponse) error {
+	for _, name := range response.Profiles {
+		if _, ok := p[name]; !ok {
+			return fmt.Errorf("%w: %s, referenced by %s", ErrUnknownProfile, name, resource)
+		}
+	}
+
+	return nil
+}
+
+// validateAll checks the profile references of every resource.
+func (p linkProfiles) validateAll(resources map[string]WebFingerResponse) error {
+	names := make([]string, 0, len(resources))
+	for resource := range resources {
+		names = append(names, resource)
+	}
+
+	sort.Strings(names)
+
+	for _, resource := range names {
+		if err := p.validate(resource, resources[resource]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// overlay returns the layer with the links and properties of the lower layer added: links whose rel the layer
+// doesn't have and properties it doesn't set, except for the excluded rels and property names.
+func (l linkProfile) overlay(lower linkProfile, excluded map[string]struct{}) linkProfile {
+	hidden := make(map[string]struct{}, len(excluded)+len(l.links))
+	for name := range excluded {
+		hidden[name] = struct{}{}
+	}
+
+	for _, link := range l.links {
+		hidden[link.Rel] = struct{}{}
+	}
+
+	links := append(make([]WebFingerLink, 0, len(l.links)+len(lower.links)), l.links...)
+
+	for _, link := range lower.links {
+		if _, ok := hidden[link.Rel]; !ok {
+			links = append(links, link)
+		}
+	}
+
+	properties := make(map[string]*string, len(l.properties)+len(lower.properties))
+
+	for name, value := range lower.properties {
+		if _, ok := hidden[name]; !ok {
+			properties[name] = value
+		}
+	}
+
+	for name, value := range l.properties {
+		properties[name] = value
+	}
+
+	if len(properties) == 0 {
+		properties = nil
+	}
+
+	return linkProfile{links: links, properties: properties}
+}
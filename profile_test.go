@@ -0,0 +1,211 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkProfiles(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Profiles = map[string]traefik_webfinger.LinkProfile{
+		"base": {
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: issuerRel, Href: "https://auth.example.com"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/base.png"},
+			},
+			Properties: propertyMap(map[string]string{"http://example.com/ns/group": "everyone"}),
+		},
+		"staff": {
+			Extends: []string{"base"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/staff.png"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/staff-large.png"},
+			},
+			Properties: propertyMap(map[string]string{"http://example.com/ns/group": "staff"}),
+		},
+		"fediverse": {
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Type: "application/activity+json", Href: "https://social.example.com/users/default"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://social.example.com/avatar.png"},
+			},
+		},
+	}
+	cfg.DefaultLinks = []traefik_webfinger.WebFingerLink{
+		{Rel: issuerRel, Href: "https://default.example.com"},
+		{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/people"},
+	}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject:  "acct:alice@example.com",
+			Profiles: []string{"staff", "fediverse"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Type: "application/activity+json", Href: "https://social.example.com/users/alice"},
+			},
+		},
+	}
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@example.com": {Subject: "acct:{user}@example.com", Profiles: []string{"fediverse", "staff"}},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	get := func(resource string) traefik_webfinger.WebFingerResponse {
+		recorder := getResource(handler, resource)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "profiles")
+
+		var response traefik_webfinger.WebFingerResponse
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+		return response
+	}
+
+	// The resource wins over its profiles, which win in order over the profiles they extend, then the defaults
+	response := get("acct:alice@example.com")
+	assert.Equal(t, []traefik_webfinger.WebFingerLink{
+		{Rel: "self", Type: "application/activity+json", Href: "https://social.example.com/users/alice"},
+		{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/staff.png"},
+		{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/staff-large.png"},
+		{Rel: issuerRel, Href: "https://auth.example.com"},
+		{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/people"},
+	}, response.Links)
+	assert.Equal(t, propertyMap(map[string]string{"http://example.com/ns/group": "staff"}), response.Properties)
+
+	// Listing the profiles the other way around changes which one wins
+	response = get("acct:bob@example.com")
+	assert.Equal(t, []traefik_webfinger.WebFingerLink{
+		{Rel: "self", Type: "application/activity+json", Href: "https://social.example.com/users/default"},
+		{Rel: "http://webfinger.net/rel/avatar", Href: "https://social.example.com/avatar.png"},
+		{Rel: issuerRel, Href: "https://auth.example.com"},
+		{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/people"},
+	}, response.Links)
+}
+
+func TestLinkProfilesInResourcesFile(t *testing.T) {
+	resourcesFile := filepath.Join(t.TempDir(), "resources.yaml")
+	writeResourcesFile(t, resourcesFile, `
+"acct:alice@example.com":
+  subject: "acct:alice@example.com"
+  profiles: [staff]
+`, time.Now())
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = resourcesFile
+	cfg.Profiles = map[string]traefik_webfinger.LinkProfile{
+		"base": {
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: issuerRel, Href: "https://auth.example.com"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/base.png"},
+			},
+		},
+		"staff": {
+			Extends: []string{"base"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/staff.png"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/staff-large.png"},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(getResource(handler, "acct:alice@example.com").Body).Decode(&response))
+	assert.Len(t, response.Links, 3)
+
+	// Unknown profiles make the file invalid
+	writeResourcesFile(t, resourcesFile, `
+"acct:alice@example.com":
+  subject: "acct:alice@example.com"
+  profiles: [alumni]
+`, time.Now())
+
+	_, err = traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrUnknownProfile)
+}
+
+func TestLinkProfileValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(cfg *traefik_webfinger.Config)
+		expectErr error
+	}{
+		{
+			name: "Unknown profile of a resource",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Resources["acct:alice@example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:alice@example.com", Profiles: []string{"staff", "alumni"},
+				}
+			},
+			expectErr: traefik_webfinger.ErrUnknownProfile,
+		},
+		{
+			name: "Unknown profile of a template",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.ResourceTemplates["acct:{user}@example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:{user}@example.com", Profiles: []string{"bots"},
+				}
+			},
+			expectErr: traefik_webfinger.ErrUnknownProfile,
+		},
+		{
+			name: "Unknown extended profile",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Profiles["bots"] = traefik_webfinger.LinkProfile{Extends: []string{"automation"}}
+			},
+			expectErr: traefik_webfinger.ErrUnknownProfile,
+		},
+		{
+			name: "Profile extending itself",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Profiles["bots"] = traefik_webfinger.LinkProfile{Extends: []string{"bots"}}
+			},
+			expectErr: traefik_webfinger.ErrProfileCycle,
+		},
+		{
+			name: "Cycle through several profiles",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Profiles["alumni"] = traefik_webfinger.LinkProfile{Extends: []string{"base", "bots"}}
+				cfg.Profiles["bots"] = traefik_webfinger.LinkProfile{Extends: []string{"staff", "alumni"}}
+			},
+			expectErr: traefik_webfinger.ErrProfileCycle,
+		},
+		{
+			name: "Link without rel",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Profiles["bots"] = traefik_webfinger.LinkProfile{Links: []traefik_webfinger.WebFingerLink{{Href: "https://example.com"}}}
+			},
+			expectErr: traefik_webfinger.ErrRelRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.Profiles = map[string]traefik_webfinger.LinkProfile{
+				"base":  {Links: []traefik_webfinger.WebFingerLink{{Rel: issuerRel, Href: "https://auth.example.com"}}},
+				"staff": {Extends: []string{"base"}},
+			}
+			tt.modify(cfg)
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, tt.expectErr)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// validateProperties checks that property names are absolute URIs (RFC 7033 section 4.4.4). Values may be null.
+func validateProperties(owner string, properties map[string]*string) error {
+	for _, name := range sortedPropertyNames(properties) {
+		if parsed, err := url.Parse(name); err != nil || parsed.Scheme == "" {
+			return fmt.Errorf("%w: %q in %s", ErrInvalidPropertyName, name, owner)
+		}
+	}
+
+	return nil
+}
+
+// validateLinks checks the relations, targets, properties and validity windows of links.
+func validateLinks(owner string, links []WebFingerLink) error {
+	for _, link := range links {
+		if link.Rel == "" {
+			return fmt.Errorf("%w: %s", ErrRelRequired, owner)
+		}
+
+		if err := validateLinkTemplate(owner, link); err != nil {
+			return err
+		}
+
+		if err := validateProperties(owner+" link "+link.Rel, link.Properties); err != nil {
+			return err
+		}
+	}
+
+	return validateLinkValidity(owner, links)
+}
+
+// validateLinkTemplate checks that a link has at most one of href and template, and that the placeholders of its
+// template are well formed.
+func validateLinkTemplate(owner string, link WebFingerLink) error {
+	if link.Template == "" {
+		return nil
+	}
+
+	if link.Href != "" {
+		return fmt.Errorf("%w: %s link %s has both href and template", ErrInvalidLinkTemplate, owner, link.Rel)
+	}
+
+	names, err := placeholders(link.Template)
+	if err != nil || len(names) == 0 {
+		return fmt.Errorf("%w: %s link %s: %q", ErrInvalidLinkTemplate, owner, link.Rel, link.Template)
+	}
+
+	for _, name := range names {
+		if strings.ContainsAny(name, " \t\"'<>") {
+			return fmt.Errorf("%w: %s link %s: placeholder {%s}", ErrInvalidLinkTemplate, owner, link.Rel, name)
+		}
+	}
+
+	return nil
+}
+
+// sortedPropertyNames returns the property names in lexical order.
+func sortedPropertyNames(properties map[string]*string) []string {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
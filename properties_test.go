@@ -0,0 +1,146 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNullableProperties(t *testing.T) {
+	resourcesFile := filepath.Join(t.TempDir(), "resources.yaml")
+	writeResourcesFile(t, resourcesFile, `
+"acct:alice@example.com":
+  subject: "acct:alice@example.com"
+  properties:
+    "http://example.com/ns/name": "Alice"
+    "http://example.com/ns/nickname": ""
+    "http://example.com/ns/phone": null
+  links:
+    - rel: "self"
+      href: "https://example.com/users/alice"
+      properties:
+        "http://example.com/ns/verified": ~
+`, time.Now())
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = resourcesFile
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := getResource(handler, "acct:alice@example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// Null and empty values stay distinct in the served document
+	var document map[string]interface{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&document))
+	assert.Equal(t, map[string]interface{}{
+		"http://example.com/ns/name":     "Alice",
+		"http://example.com/ns/nickname": "",
+		"http://example.com/ns/phone":    nil,
+	}, document["properties"])
+
+	links, _ := document["links"].([]interface{})
+	require.Len(t, links, 1)
+	link, _ := links[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"http://example.com/ns/verified": nil}, link["properties"])
+
+	// In XRD, null values are marked with xsi:nil
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Header.Set("Accept", "application/xrd+xml")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`)
+	assert.Contains(t, body, `<Property type="http://example.com/ns/nickname"></Property>`)
+	assert.Contains(t, body, `<Property type="http://example.com/ns/phone" xsi:nil="true"></Property>`)
+	assert.Contains(t, body, `<Property type="http://example.com/ns/verified" xsi:nil="true"></Property>`)
+}
+
+func TestPropertiesWithoutNullsInXRD(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject:    "acct:alice@example.com",
+			Properties: propertyMap(map[string]string{"http://example.com/ns/name": "Alice"}),
+		},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Header.Set("Accept", "application/xrd+xml")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "xsi")
+}
+
+func TestPropertyNameValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *traefik_webfinger.Config)
+	}{
+		{
+			name: "Resource property",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Resources["acct:alice@example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject:    "acct:alice@example.com",
+					Properties: map[string]*string{"name": nil},
+				}
+			},
+		},
+		{
+			name: "Link property",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Resources["acct:alice@example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:alice@example.com",
+					Links: []traefik_webfinger.WebFingerLink{
+						{Rel: "self", Properties: propertyMap(map[string]string{"/ns/verified": "yes"})},
+					},
+				}
+			},
+		},
+		{
+			name: "Default property",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.DefaultProperties = propertyMap(map[string]string{"organization": "Example Inc."})
+			},
+		},
+		{
+			name: "Profile property",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Profiles = map[string]traefik_webfinger.LinkProfile{"staff": {Properties: map[string]*string{"": nil}}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			tt.modify(cfg)
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidPropertyName)
+		})
+	}
+}
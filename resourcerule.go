@@ -0,0 +1,179 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// maxRuleInstructions caps the size of the compiled program of a resource rule, which grows with alternations and
+// counted repetitions such as [0-9]{1000}.
+const maxRuleInstructions = 1000
+
+// ResourceRule answers the resources matching a regular expression.
+type ResourceRule struct {
+	// Regular expression matched against the whole resource URI, such as urn:example:employee:(?P<id>[0-9]+)
+	Match string `json:"match,omitempty" yaml:"match"`
+	// Response whose subject, aliases, link hrefs and link templates may contain {name} placeholders of named
+	// capture groups
+	Response WebFingerResponse `json:"response,omitempty" yaml:"response"`
+}
+
+// resourceRule is a compiled ResourceRule.
+type resourceRule struct {
+	matcher *regexp.Regexp
+	entry   resourceEntry
+	// Indexes of the groups the placeholders of the response refer to
+	referenced []int
+}
+
+// newResourceRules validates and compiles the resource rules, keeping their order, and loads their responses with
+// the defaults.
+func newResourceRules(rules []ResourceRule, defaults responseDefaults) ([]resourceRule, error) {
+	compiled := make([]resourceRule, 0, len(rules))
+
+	for i, rule := range rules {
+		matcher, err := compileResourceRule(rule.Match)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateResponse(rule.Match, rule.Response); err != nil {
+			return nil, err
+		}
+
+		values := append([]string{rule.Response.Subject}, rule.Response.Aliases...)
+		for _, link := range rule.Response.Links {
+			values = append(values, link.Href)
+		}
+
+		var referenced []int
+
+		for _, value := range values {
+			names, err := placeholders(value)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range names {
+				index := matcher.SubexpIndex(name)
+				if index < 0 {
+					return nil, fmt.Errorf("%w: rule %d: {%s} is not a named group of %q", ErrInvalidResourceRule, i, name, rule.Match)
+				}
+
+				referenced = append(referenced, index)
+			}
+		}
+
+		// Link templates may also hold placeholders for the client, which groups must not replace
+		for _, link := range rule.Response.Links {
+			names, err := placeholders(link.Template)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range names {
+				index := matcher.SubexpIndex(name)
+				if index >= 0 && name == clientVariable {
+					return nil, fmt.Errorf("%w: rule %d: group %q would replace the {%s} placeholder of link templates",
+						ErrInvalidResourceRule, i, name, name)
+				}
+
+				if index >= 0 {
+					referenced = append(referenced, index)
+				}
+			}
+		}
+
+		if err := defaults.profiles.validate(rule.Match, rule.Response); err != nil {
+			return nil, err
+		}
+
+		entry, err := defaults.load(rule.Match, rule.Response)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled = append(compiled, resourceRule{matcher: matcher, entry: entry, referenced: referenced})
+	}
+
+	return compiled, nil
+}
+
+// compileResourceRule anchors the expression to the whole resource and rejects overly complex ones.
+func compileResourceRule(expression string) (*regexp.Regexp, error) {
+	if expression == "" {
+		return nil, fmt.Errorf("%w: match is required", ErrInvalidResourceRule)
+	}
+
+	anchored := "^(?:" + expression + ")$"
+
+	parsed, err := syntax.Parse(anchored, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResourceRule, err.Error())
+	}
+
+	program, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResourceRule, err.Error())
+	}
+
+	if len(program.Inst) > maxRuleInstructions {
+		return nil, fmt.Errorf("%w: %q compiles to %d instructions, at most %d are allowed",
+			ErrInvalidResourceRule, expression, len(program.Inst), maxRuleInstructions)
+	}
+
+	return regexp.Compile(anchored)
+}
+
+// render returns the response for the resource, and whether the rule matched it. A matching rule renders nothing
+// when a group its placeholders refer to did not take part in the match, or when the rendered subject is invalid or
+// names a host outside the domains.
+func (r resourceRule) render(resource string, domains []string) (entry resourceEntry, matched, ok bool) {
+	match := r.matcher.FindStringSubmatchIndex(resource)
+	if match == nil {
+		return resourceEntry{}, false, false
+	}
+
+	for _, index := range r.referenced {
+		if match[2*index] < 0 {
+			return resourceEntry{}, true, false
+		}
+	}
+
+	replacements := make([]string, 0, len(match))
+
+	for i, name := range r.matcher.SubexpNames() {
+		if name != "" && match[2*i] >= 0 {
+			replacements = append(replacements, "{"+name+"}", resource[match[2*i]:match[2*i+1]])
+		}
+	}
+
+	// The configured response was validated by New, only the subject can become invalid by rendering. Link
+	// templates in particular may have no placeholder left once the groups are replaced.
+	entry = r.entry.render(strings.NewReplacer(replacements...))
+	if entry.response.Subject == "" {
+		return resourceEntry{}, true, false
+	}
+
+	// Subjects without a host, such as URNs, may be anything
+	if _, hasHost := resourceHost(entry.response.Subject); hasHost {
+		if _, served := matchDomain(entry.response.Subject, domains); !served {
+			return resourceEntry{}, true, false
+		}
+	}
+
+	return entry, true, true
+}
+
+// matchesResourceRule reports whether one of the resource rules matches the resource.
+func (w *WebFinger) matchesResourceRule(resource string) bool {
+	for _, rule := range w.rules {
+		if rule.matcher.MatchString(resource) {
+			return true
+		}
+	}
+
+	return false
+}
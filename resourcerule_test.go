@@ -0,0 +1,214 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceRules(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"https://example.com/people/1": {Subject: "https://example.com/people/1", Aliases: []string{"acct:founder@example.com"}},
+	}
+	cfg.ResourceRules = []traefik_webfinger.ResourceRule{
+		{
+			Match: `https://example\.com/people/(?P<id>[0-9]+)`,
+			Response: traefik_webfinger.WebFingerResponse{
+				Subject: "https://example.com/people/{id}",
+				Links: []traefik_webfinger.WebFingerLink{
+					{Rel: "http://webfinger.net/rel/profile-page", Href: "https://intranet.example.com/people/{id}"},
+				},
+			},
+		},
+		{
+			Match: `urn:example:employee:(?P<id>[0-9]+)|https://example\.com/people/(?P<team>[a-z]+)/(?P<name>[a-z]+)`,
+			Response: traefik_webfinger.WebFingerResponse{
+				Subject: "urn:example:employee:{id}",
+				Links: []traefik_webfinger.WebFingerLink{
+					{Rel: "http://webfinger.net/rel/profile-page", Href: "https://intranet.example.com/employees/{id}"},
+				},
+			},
+		},
+		{
+			Match:    `urn:example:contractor:(?P<id>[0-9]+)|urn:example:contractor:(?P<agency>[a-z]+)`,
+			Response: traefik_webfinger.WebFingerResponse{Subject: "urn:example:contractor:{agency}"},
+		},
+		{
+			Match:    `urn:example:partner:(?P<host>[a-z.]+)`,
+			Response: traefik_webfinger.WebFingerResponse{Subject: "acct:partner@{host}"},
+		},
+		{
+			Match: `urn:example:employee:[0-9]+`,
+			Response: traefik_webfinger.WebFingerResponse{
+				Subject: "urn:example:unreachable",
+			},
+		},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		resource        string
+		expectedCode    int
+		expectedSubject string
+		expectedHref    string
+	}{
+		{
+			name:            "Explicit resources take precedence",
+			resource:        "https://example.com/people/1",
+			expectedCode:    http.StatusOK,
+			expectedSubject: "https://example.com/people/1",
+		},
+		{
+			name:            "First matching rule",
+			resource:        "https://example.com/people/1234",
+			expectedCode:    http.StatusOK,
+			expectedSubject: "https://example.com/people/1234",
+			expectedHref:    "https://intranet.example.com/people/1234",
+		},
+		{
+			name:            "URI outside the configured domains",
+			resource:        "urn:example:employee:1234",
+			expectedCode:    http.StatusOK,
+			expectedSubject: "urn:example:employee:1234",
+			expectedHref:    "https://intranet.example.com/employees/1234",
+		},
+		{
+			name:         "Placeholder of a group outside the match",
+			resource:     "urn:example:contractor:1234",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Placeholder of a group in the other alternative",
+			resource:     "https://example.com/people/ops/bob",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Rendered subject outside the configured domains",
+			resource:     "urn:example:partner:example.net",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Rules are anchored",
+			resource:     "urn:example:employee:1234:extra",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "No rule matches",
+			resource:     "urn:example:visitor:1234",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := getResource(handler, tt.resource)
+			require.Equal(t, tt.expectedCode, recorder.Code)
+
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var response traefik_webfinger.WebFingerResponse
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+			assert.Equal(t, tt.expectedSubject, response.Subject)
+
+			if tt.expectedHref != "" {
+				assert.Equal(t, tt.expectedHref, response.Links[0].Href)
+			}
+		})
+	}
+}
+
+func TestResourceRulesHostBinding(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.HostBinding = true
+	cfg.ResourceRules = []traefik_webfinger.ResourceRule{
+		{Match: `urn:example:employee:(?P<id>[0-9]+)`, Response: traefik_webfinger.WebFingerResponse{Subject: "urn:example:employee:{id}"}},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// URIs without a host are served on any configured host
+	for host, expectedCode := range map[string]int{"example.com": http.StatusOK, "other.example.net": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=urn:example:employee:1234", nil)
+		req.Host = host
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, expectedCode, recorder.Code, host)
+	}
+}
+
+func TestResourceRuleValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      traefik_webfinger.ResourceRule
+		expectErr error
+	}{
+		{
+			name:      "Missing expression",
+			rule:      traefik_webfinger.ResourceRule{Response: traefik_webfinger.WebFingerResponse{Subject: "urn:x"}},
+			expectErr: traefik_webfinger.ErrInvalidResourceRule,
+		},
+		{
+			name:      "Invalid expression",
+			rule:      traefik_webfinger.ResourceRule{Match: `urn:(?P<id>[0-9]+`, Response: traefik_webfinger.WebFingerResponse{Subject: "urn:x"}},
+			expectErr: traefik_webfinger.ErrInvalidResourceRule,
+		},
+		{
+			name: "Too complex expression",
+			rule: traefik_webfinger.ResourceRule{
+				Match:    `urn:(?P<id>[0-9]{900}(a|b|c){200})`,
+				Response: traefik_webfinger.WebFingerResponse{Subject: "urn:x"},
+			},
+			expectErr: traefik_webfinger.ErrInvalidResourceRule,
+		},
+		{
+			name: "Nested repetition",
+			rule: traefik_webfinger.ResourceRule{
+				Match:    `urn:((?P<id>[a-z]{1,40}-){1,40})`,
+				Response: traefik_webfinger.WebFingerResponse{Subject: "urn:x"},
+			},
+			expectErr: traefik_webfinger.ErrInvalidResourceRule,
+		},
+		{
+			name:      "Unknown group",
+			rule:      traefik_webfinger.ResourceRule{Match: `urn:(?P<id>[0-9]+)`, Response: traefik_webfinger.WebFingerResponse{Subject: "urn:{name}"}},
+			expectErr: traefik_webfinger.ErrInvalidResourceRule,
+		},
+		{
+			name:      "Malformed placeholder",
+			rule:      traefik_webfinger.ResourceRule{Match: `urn:(?P<id>[0-9]+)`, Response: traefik_webfinger.WebFingerResponse{Subject: "urn:{id"}},
+			expectErr: traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name:      "Missing subject",
+			rule:      traefik_webfinger.ResourceRule{Match: `urn:(?P<id>[0-9]+)`},
+			expectErr: traefik_webfinger.ErrSubjectRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.ResourceRules = []traefik_webfinger.ResourceRule{tt.rule}
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, tt.expectErr)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package traefik_webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dirFile is the last seen state of a JRD file in the resources directory.
+type dirFile struct {
+	modTime  time.Time
+	size     int64
+	response WebFingerResponse
+	// Whether response holds a valid document, which is kept when the file becomes invalid
+	loaded bool
+}
+
+// resourcesDir tracks a directory in which every .json file is the JRD of one resource, keyed by its subject.
+type resourcesDir struct {
+	path     string
+	domains  []string
+	profiles linkProfiles
+	files    map[string]*dirFile
+	// Version of the store the resources were last checked against
+	storeVersion uint64
+}
+
+// newResourcesDir creates a tracker for the directory, which must exist.
+func newResourcesDir(path string, domains []string, profiles linkProfiles) (*resourcesDir, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading resources directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s is not a directory", ErrInvalidResourcesFile, path)
+	}
+
+	return &resourcesDir{path: path, domains: domains, profiles: profiles, files: make(map[string]*dirFile)}, nil
+}
+
+// scan applies new, changed and removed files. It reports whether anything changed, along with the errors of individual files.
+func (d *resourcesDir) scan() (bool, []error) {
+	matches, err := filepath.Glob(filepath.Join(d.path, "*.json"))
+	if err != nil {
+		return false, []error{err}
+	}
+
+	var errs []error
+
+	changed := false
+	seen := make(map[string]struct{}, len(matches))
+
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		seen[path] = struct{}{}
+
+		file, exists := d.files[path]
+		if exists && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+			continue
+		}
+
+		if !exists {
+			file = &dirFile{}
+			d.files[path] = file
+		}
+
+		file.modTime, file.size = info.ModTime(), info.Size()
+
+		response, err := d.load(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		file.response, file.loaded = response, true
+		changed = true
+	}
+
+	for path := range d.files {
+		if _, ok := seen[path]; !ok {
+			delete(d.files, path)
+
+			changed = true
+		}
+	}
+
+	return changed, errs
+}
+
+// load reads and validates a single JRD file.
+func (d *resourcesDir) load(path string) (WebFingerResponse, error) {
+	var response WebFingerResponse
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return response, fmt.Errorf("reading resource file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return response, fmt.Errorf("%w: %s: %s", ErrInvalidResourcesFile, path, err.Error())
+	}
+
+	if err := validateResponse(path, response); err != nil {
+		return response, err
+	}
+
+	if err := d.profiles.validate(path, response); err != nil {
+		return response, err
+	}
+
+	if _, ok := matchDomain(response.Subject, d.domains); !ok {
+		return response, fmt.Errorf("%w: %s in %s for domains %s",
+			ErrResourceDomainMatch, response.Subject, path, strings.Join(d.domains, ", "))
+	}
+
+	return response, nil
+}
+
+// resources returns the loaded documents keyed by subject. When several files share a subject, the first file by name
+// wins. Owners maps the resources of the other layers, and the aliases they claim, to their resource; files claiming
+// an alias of another resource are skipped.
+func (d *resourcesDir) resources(owners map[string]string) (map[string]WebFingerResponse, []error) {
+	paths := make([]string, 0, len(d.files))
+	for path := range d.files {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	var errs []error
+
+	resources := make(map[string]WebFingerResponse, len(paths))
+	sources := make(map[string]string, len(paths))
+
+	// Resources win over aliases, whichever file they come from
+	for _, path := range paths {
+		if file := d.files[path]; file.loaded {
+			owners[file.response.Subject] = file.response.Subject
+		}
+	}
+
+	for _, path := range paths {
+		file := d.files[path]
+		if !file.loaded {
+			continue
+		}
+
+		if first, ok := sources[file.response.Subject]; ok {
+			errs = append(errs, fmt.Errorf("%w: %s in %s, already defined in %s", ErrDuplicateResource, file.response.Subject, path, first))
+			continue
+		}
+
+		if err := claimAliases(owners, file.response.Subject, file.response, d.domains); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+
+		sources[file.response.Subject] = path
+		resources[file.response.Subject] = file.response
+	}
+
+	return resources, errs
+}
+
+// refreshResourcesDir rescans the directory and updates the store when anything changed, in the directory or in the
+// other layers whose aliases the files may conflict with.
+func (w *WebFinger) refreshResourcesDir(dir *resourcesDir) error {
+	changed, errs := dir.scan()
+	for _, err := range errs {
+		log.Printf("webfinger %s: skipping resource file: %v", w.name, err)
+	}
+
+	owners, version, err := w.resources.owners(layerDir)
+	if err != nil {
+		return err
+	}
+
+	if !changed && version == dir.storeVersion {
+		return nil
+	}
+
+	resources, skipped := dir.resources(owners)
+	for _, err := range skipped {
+		log.Printf("webfinger %s: skipping resource file: %v", w.name, err)
+	}
+
+	if err := w.resources.set(layerDir, resources); err != nil {
+		return fmt.Errorf("%s: %w", dir.path, err)
+	}
+
+	// Replacing the layer bumped the version once more
+	dir.storeVersion = version + 1
+
+	return nil
+}
+
+// watchResourcesDir periodically rescans the directory.
+func (w *WebFinger) watchResourcesDir(ctx context.Context, dir *resourcesDir, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.refreshResourcesDir(dir); err != nil {
+				log.Printf("webfinger %s: keeping previous resources: %v", w.name, err)
+			}
+		}
+	}
+}
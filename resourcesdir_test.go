@@ -0,0 +1,158 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourcesDir(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+
+	writeResourcesFile(t, filepath.Join(dir, "alice.json"), `{"subject": "acct:alice@example.com"}`, start)
+	writeResourcesFile(t, filepath.Join(dir, "bob.json"), `{"subject": "acct:bob@example.com"}`, start)
+	writeResourcesFile(t, filepath.Join(dir, "broken.json"), `{"subject": `, start)
+	writeResourcesFile(t, filepath.Join(dir, "foreign.json"), `{"subject": "acct:eve@example.org"}`, start)
+	writeResourcesFile(t, filepath.Join(dir, "notes.txt"), `{"subject": "acct:notes@example.com"}`, start)
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesDir = dir
+	cfg.ReloadInterval = "10ms"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// Invalid files are skipped without dropping the others
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:alice@example.com"))
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:bob@example.com"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:eve@example.org"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:notes@example.com"))
+
+	// New files are added and removed files dropped
+	writeResourcesFile(t, filepath.Join(dir, "carol.json"), `{"subject": "acct:carol@example.com"}`, start)
+	require.NoError(t, os.Remove(filepath.Join(dir, "bob.json")))
+
+	require.Eventually(t, func() bool {
+		return statusOf(handler, "acct:carol@example.com") == http.StatusOK &&
+			statusOf(handler, "acct:bob@example.com") == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+
+	// A file changed to an invalid document keeps its previous version
+	writeResourcesFile(t, filepath.Join(dir, "alice.json"), `{"links": [{"rel": "self"}]}`, start.Add(time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:alice@example.com"))
+
+	// A changed subject replaces the resource of the file
+	writeResourcesFile(t, filepath.Join(dir, "alice.json"), `{"subject": "acct:alice.smith@example.com"}`, start.Add(2*time.Minute))
+
+	require.Eventually(t, func() bool {
+		return statusOf(handler, "acct:alice.smith@example.com") == http.StatusOK &&
+			statusOf(handler, "acct:alice@example.com") == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestResourcesDirDuplicateSubject(t *testing.T) {
+	dir := t.TempDir()
+
+	writeResourcesFile(t, filepath.Join(dir, "a.json"),
+		`{"subject": "acct:alice@example.com", "links": [{"rel": "self", "href": "https://example.com/a"}]}`, time.Now())
+	writeResourcesFile(t, filepath.Join(dir, "b.json"),
+		`{"subject": "acct:alice@example.com", "links": [{"rel": "self", "href": "https://example.com/b"}]}`, time.Now())
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesDir = dir
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := getResource(handler, "acct:alice@example.com")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "https://example.com/a")
+
+	// Files claiming an alias of an earlier file are skipped
+	writeResourcesFile(t, filepath.Join(dir, "c.json"),
+		`{"subject": "acct:carol@example.com", "aliases": ["https://example.com/@carol"]}`, time.Now())
+	writeResourcesFile(t, filepath.Join(dir, "d.json"),
+		`{"subject": "acct:dave@example.com", "aliases": ["https://example.com/@carol"]}`, time.Now())
+
+	handler, err = traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder = getResource(handler, "https://example.com/@carol")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "acct:carol@example.com")
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:dave@example.com"))
+
+	// The directory must exist
+	cfg.ResourcesDir = filepath.Join(dir, "missing")
+	_, err = traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestResourcesDirAliasConflicts(t *testing.T) {
+	dir := t.TempDir()
+	resourcesFile := filepath.Join(t.TempDir(), "resources.json")
+	start := time.Now().Add(-time.Hour)
+
+	writeResourcesFile(t, resourcesFile, `{"acct:bob@example.com": {"subject": "acct:bob@example.com", "aliases": ["https://example.com/@bob"]}}`, start)
+	writeResourcesFile(t, filepath.Join(dir, "eve.json"), `{"subject": "acct:eve@example.com", "aliases": ["https://example.com/@alice"]}`, start)
+	writeResourcesFile(t, filepath.Join(dir, "mallory.json"), `{"subject": "acct:mallory@example.com", "aliases": ["https://example.com/@bob"]}`, start)
+	writeResourcesFile(t, filepath.Join(dir, "dave.json"), `{"subject": "acct:dave@example.com", "aliases": ["https://example.com/@dave"]}`, start)
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = resourcesFile
+	cfg.ResourcesDir = dir
+	cfg.ReloadInterval = "10ms"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com", Aliases: []string{"https://example.com/@alice"}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// Only the files claiming aliases of other sources are skipped
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:eve@example.com"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:mallory@example.com"))
+	assert.Equal(t, http.StatusOK, statusOf(handler, "https://example.com/@dave"))
+	assert.Contains(t, getResource(handler, "https://example.com/@alice").Body.String(), `"subject":"acct:alice@example.com"`)
+
+	// Other files are still picked up
+	writeResourcesFile(t, filepath.Join(dir, "carol.json"), `{"subject": "acct:carol@example.com"}`, start)
+
+	require.Eventually(t, func() bool {
+		return statusOf(handler, "acct:carol@example.com") == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:eve@example.com"))
+
+	// A skipped file is served once the other source releases the alias
+	writeResourcesFile(t, resourcesFile, `{"acct:bob@example.com": {"subject": "acct:bob@example.com"}}`, start.Add(time.Minute))
+
+	require.Eventually(t, func() bool {
+		return statusOf(handler, "https://example.com/@bob") == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, getResource(handler, "https://example.com/@bob").Body.String(), `"subject":"acct:mallory@example.com"`)
+}
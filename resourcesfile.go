@@ -0,0 +1,99 @@
+package traefik_webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultReloadInterval is how often external resource sources are checked for changes.
+const defaultReloadInterval = 10 * time.Second
+
+// loadResourcesFile reads a JSON or YAML file mapping resources to their responses, and validates it.
+func loadResourcesFile(path string, domains []string, profiles linkProfiles) (map[string]WebFingerResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading resources file: %w", err)
+	}
+
+	resources := make(map[string]WebFingerResponse)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &resources)
+	default:
+		err = json.Unmarshal(data, &resources)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidResourcesFile, path, err.Error())
+	}
+
+	if err := validateResources(resources, domains); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := profiles.validateAll(resources); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return resources, nil
+}
+
+// parseReloadInterval parses the polling interval of external resource sources.
+func parseReloadInterval(interval string) (time.Duration, error) {
+	if interval == "" {
+		return defaultReloadInterval, nil
+	}
+
+	duration, err := time.ParseDuration(interval)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidReloadInterval, interval)
+	}
+
+	return duration, nil
+}
+
+// watchResourcesFile polls the file modification time and swaps in its resources whenever it changes and is valid.
+func (w *WebFinger) watchResourcesFile(ctx context.Context, path string, interval time.Duration, info os.FileInfo) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := os.Stat(path)
+		if err != nil {
+			log.Printf("webfinger %s: checking resources file: %v", w.name, err)
+			continue
+		}
+
+		if current.ModTime().Equal(info.ModTime()) && current.Size() == info.Size() {
+			continue
+		}
+
+		// Remember the new state even if it is invalid so the error is only reported once per change
+		info = current
+
+		resources, err := loadResourcesFile(path, w.domains, w.resources.defaults.profiles)
+		if err != nil {
+			log.Printf("webfinger %s: keeping previous resources: %v", w.name, err)
+			continue
+		}
+
+		if err := w.resources.set(layerFile, resources); err != nil {
+			log.Printf("webfinger %s: keeping previous resources: %s: %v", w.name, path, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourcesFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.json")
+	start := time.Now().Add(-time.Hour)
+	writeResourcesFile(t, path, `{"acct:alice@example.com": {"subject": "acct:alice@example.com"}}`, start)
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = path
+	cfg.ReloadInterval = "10ms"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:inline@example.com": {Subject: "acct:inline@example.com"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:alice@example.com"))
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:inline@example.com"))
+
+	// A valid change is picked up
+	writeResourcesFile(t, path, `{"acct:bob@example.com": {"subject": "acct:bob@example.com"}}`, start.Add(time.Minute))
+
+	require.Eventually(t, func() bool {
+		return statusOf(handler, "acct:bob@example.com") == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:alice@example.com"))
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:inline@example.com"))
+
+	// An invalid change keeps the previous resources
+	writeResourcesFile(t, path, `{"acct:carol@example.org": {"subject": "acct:carol@example.org"}}`, start.Add(2*time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:bob@example.com"))
+
+	writeResourcesFile(t, path, `{"acct:carol@example.com": `, start.Add(3*time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:bob@example.com"))
+}
+
+func TestResourcesFileYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.yaml")
+	writeResourcesFile(t, path, `
+"acct:alice@example.com":
+  subject: "acct:alice@example.com"
+  links:
+    - rel: "self"
+      href: "https://example.com/users/alice"
+`, time.Now())
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = path
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"href":"https://example.com/users/alice"`)
+}
+
+func TestResourcesFileValidation(t *testing.T) {
+	dir := t.TempDir()
+
+	invalid := filepath.Join(dir, "invalid.json")
+	writeResourcesFile(t, invalid, `{"acct:alice@example.com": {"links": [{"rel": "self"}]}}`, time.Now())
+
+	malformed := filepath.Join(dir, "malformed.yaml")
+	writeResourcesFile(t, malformed, "acct:alice@example.com: [", time.Now())
+
+	valid := filepath.Join(dir, "valid.json")
+	writeResourcesFile(t, valid, `{}`, time.Now())
+
+	tests := []struct {
+		name     string
+		file     string
+		interval string
+		expected error
+	}{
+		{name: "Missing subject", file: invalid, expected: traefik_webfinger.ErrSubjectRequired},
+		{name: "Malformed file", file: malformed, expected: traefik_webfinger.ErrInvalidResourcesFile},
+		{name: "Missing file", file: filepath.Join(dir, "missing.json"), expected: os.ErrNotExist},
+		{name: "Invalid interval", file: valid, interval: "soon", expected: traefik_webfinger.ErrInvalidReloadInterval},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.ResourcesFile = tt.file
+			cfg.ReloadInterval = tt.interval
+
+			_, err := traefik_webfinger.New(context.Background(), next, cfg, "test")
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
+
+func TestResourcesFileAliasConflicts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.json")
+	start := time.Now().Add(-time.Hour)
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = path
+	cfg.ReloadInterval = "10ms"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com", Aliases: []string{"https://example.com/@alice"}},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	// Another layer may not claim an alias of an inline resource
+	writeResourcesFile(t, path, `{"acct:bob@example.com": {"subject": "acct:bob@example.com", "aliases": ["https://example.com/@alice"]}}`, start)
+
+	_, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrDuplicateAlias)
+
+	// Aliases of a record overridden by the inline one are not indexed
+	writeResourcesFile(t, path, `{
+		"acct:alice@example.com": {"subject": "acct:alice@example.com", "aliases": ["https://example.com/old-alice"]},
+		"acct:bob@example.com": {"subject": "acct:bob@example.com", "aliases": ["https://example.com/@bob"]}
+	}`, start.Add(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, statusOf(handler, "https://example.com/@alice"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "https://example.com/old-alice"))
+	assert.Equal(t, http.StatusOK, statusOf(handler, "https://example.com/@bob"))
+
+	// A conflicting reload keeps the previous resources
+	writeResourcesFile(t, path, `{
+		"acct:carol@example.com": {"subject": "acct:carol@example.com", "aliases": ["https://example.com/@alice"]}
+	}`, start.Add(2*time.Minute))
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:bob@example.com"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:carol@example.com"))
+	assert.Contains(t, getResource(handler, "https://example.com/@alice").Body.String(), `"subject":"acct:alice@example.com"`)
+}
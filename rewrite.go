@@ -0,0 +1,241 @@
+package traefik_webfinger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RewriteRule maps an internal origin to a public one in JRD documents returned by the backend.
+type RewriteRule struct {
+	// Internal scheme and host, such as http://mastodon-web:3000
+	From string `json:"from,omitempty" yaml:"from"`
+	// Public scheme and host, such as https://social.example.com
+	To string `json:"to,omitempty" yaml:"to"`
+}
+
+// rewriteRule is a validated RewriteRule.
+type rewriteRule struct {
+	fromOrigin string
+	toOrigin   string
+	fromHost   string
+	toHost     string
+}
+
+// newRewriteRules validates the rewrite rules.
+func newRewriteRules(rules []RewriteRule) ([]rewriteRule, error) {
+	compiled := make([]rewriteRule, 0, len(rules))
+
+	for _, rule := range rules {
+		from, err := parseOrigin(rule.From)
+		if err != nil {
+			return nil, err
+		}
+
+		to, err := parseOrigin(rule.To)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled = append(compiled, rewriteRule{
+			fromOrigin: from.Scheme + "://" + from.Host,
+			toOrigin:   to.Scheme + "://" + to.Host,
+			fromHost:   from.Host,
+			toHost:     to.Host,
+		})
+	}
+
+	return compiled, nil
+}
+
+// parseOrigin parses a scheme and host without path, query or fragment.
+func parseOrigin(origin string) (*url.URL, error) {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.User != nil ||
+		strings.TrimSuffix(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRewrite, origin)
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+
+	return parsed, nil
+}
+
+// rewriteURI applies the first matching rule: URIs starting with an internal origin get the public origin, and
+// opaque URIs such as acct:user@host get the public host.
+func rewriteURI(rules []rewriteRule, value string) string {
+	lower := strings.ToLower(value)
+
+	for _, rule := range rules {
+		if strings.HasPrefix(lower, rule.fromOrigin) {
+			rest := value[len(rule.fromOrigin):]
+			if rest == "" || strings.ContainsAny(rest[:1], "/?#") {
+				return rule.toOrigin + rest
+			}
+		}
+
+		// Hierarchical URIs only match by origin
+		if strings.Contains(value, "//") {
+			continue
+		}
+
+		if at := strings.LastIndex(value, "@"); at >= 0 && strings.EqualFold(value[at+1:], rule.fromHost) {
+			return value[:at+1] + rule.toHost
+		}
+	}
+
+	return value
+}
+
+// rewriteResponse rewrites the subject, aliases, link hrefs and link templates of a document.
+func rewriteResponse(rules []rewriteRule, response WebFingerResponse) WebFingerResponse {
+	if len(rules) == 0 {
+		return response
+	}
+
+	// Members that are not rewritten, such as properties, are kept as they are
+	rewritten := response
+	rewritten.Subject = rewriteURI(rules, response.Subject)
+	rewritten.Aliases = make([]string, 0, len(response.Aliases))
+	rewritten.Links = make([]WebFingerLink, 0, len(response.Links))
+
+	for _, alias := range response.Aliases {
+		rewritten.Aliases = append(rewritten.Aliases, rewriteURI(rules, alias))
+	}
+
+	for _, link := range response.Links {
+		link.Href = rewriteURI(rules, link.Href)
+		link.Template = rewriteURI(rules, link.Template)
+		rewritten.Links = append(rewritten.Links, link)
+	}
+
+	return rewritten
+}
+
+// rewriteDocument rewrites a raw JRD document, keeping members the WebFingerResponse type does not know about.
+func rewriteDocument(rules []rewriteRule, data []byte) ([]byte, bool) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, false
+	}
+
+	rewriteMember := func(object map[string]interface{}, name string) {
+		if value, ok := object[name].(string); ok {
+			object[name] = rewriteURI(rules, value)
+		}
+	}
+
+	rewriteMember(document, "subject")
+
+	if aliases, ok := document["aliases"].([]interface{}); ok {
+		for i, alias := range aliases {
+			if value, ok := alias.(string); ok {
+				aliases[i] = rewriteURI(rules, value)
+			}
+		}
+	}
+
+	if links, ok := document["links"].([]interface{}); ok {
+		for _, link := range links {
+			if object, ok := link.(map[string]interface{}); ok {
+				rewriteMember(object, "href")
+				rewriteMember(object, "template")
+			}
+		}
+	}
+
+	rewritten, err := json.Marshal(document)
+	if err != nil {
+		return nil, false
+	}
+
+	return rewritten, true
+}
+
+// rewritingResponse passes a backend response through, capturing successful JRD documents so they can be rewritten.
+type rewritingResponse struct {
+	http.ResponseWriter
+	rules    []rewriteRule
+	status   int
+	decided  bool
+	capture  bool
+	captured bytes.Buffer
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (r *rewritingResponse) WriteHeader(status int) {
+	if r.decided {
+		return
+	}
+
+	r.decided = true
+	r.status = status
+
+	header := r.Header()
+	if status == http.StatusOK && isJRDContentType(header.Get("Content-Type")) && header.Get("Content-Encoding") == "" {
+		r.capture = true
+		return
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter, falling back to streaming when the document grows too large.
+func (r *rewritingResponse) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+
+	if !r.capture {
+		return r.ResponseWriter.Write(data)
+	}
+
+	if r.captured.Len()+len(data) <= maxBackendBodySize {
+		return r.captured.Write(data)
+	}
+
+	r.capture = false
+	r.ResponseWriter.WriteHeader(r.status)
+
+	if _, err := r.ResponseWriter.Write(r.captured.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return r.ResponseWriter.Write(data)
+}
+
+// finish sends the captured document, rewritten when it is a valid JRD document.
+func (r *rewritingResponse) finish() {
+	if !r.capture {
+		return
+	}
+
+	body := r.captured.Bytes()
+	if rewritten, ok := rewriteDocument(r.rules, body); ok {
+		body = rewritten
+	}
+
+	r.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	r.ResponseWriter.WriteHeader(r.status)
+
+	_, _ = r.ResponseWriter.Write(body)
+}
+
+// passToBackend hands the request to the next handler, rewriting internal URLs in its JRD responses.
+func (w *WebFinger) passToBackend(responseWriter http.ResponseWriter, req *http.Request) {
+	if len(w.rewrites) == 0 {
+		w.next.ServeHTTP(responseWriter, req)
+		return
+	}
+
+	backendReq := req.Clone(req.Context())
+	// The body has to be readable, so the backend must not compress it
+	backendReq.Header.Del("Accept-Encoding")
+
+	rewriter := &rewritingResponse{ResponseWriter: responseWriter, rules: w.rewrites}
+	w.next.ServeHTTP(rewriter, backendReq)
+	rewriter.finish()
+}
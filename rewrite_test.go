@@ -0,0 +1,119 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewritePassthroughJRD(t *testing.T) {
+	backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("Accept-Encoding"))
+
+		body := `{
+			"subject": "acct:alice@mastodon-web:3000",
+			"aliases": ["http://mastodon-web:3000/@alice", "http://mastodon-web:30001/@alice"],
+			"properties": {"http://example.com/ns/kind": "person"},
+			"links": [
+				{"rel": "self", "type": "application/activity+json", "href": "HTTP://Mastodon-Web:3000/users/alice"},
+				{"rel": "http://ostatus.org/schema/1.0/subscribe", "template": "http://mastodon-web:3000/authorize_interaction?uri={uri}"}
+			]
+		}`
+		rw.Header().Set("Content-Type", "application/jrd+json; charset=utf-8")
+		rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, err := io.WriteString(rw, body)
+		require.NoError(t, err)
+	})
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Passthrough = true
+	cfg.Rewrites = []traefik_webfinger.RewriteRule{
+		{From: "http://mastodon-web:3000", To: "https://social.example.com"},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, strconv.Itoa(recorder.Body.Len()), recorder.Header().Get("Content-Length"))
+
+	var document map[string]interface{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&document))
+
+	assert.Equal(t, "acct:alice@social.example.com", document["subject"])
+	assert.Equal(t, []interface{}{"https://social.example.com/@alice", "http://mastodon-web:30001/@alice"}, document["aliases"])
+	assert.Equal(t, map[string]interface{}{"http://example.com/ns/kind": "person"}, document["properties"])
+
+	links, ok := document["links"].([]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "https://social.example.com/users/alice", links[0].(map[string]interface{})["href"])
+	assert.Equal(t, "https://social.example.com/authorize_interaction?uri={uri}", links[1].(map[string]interface{})["template"])
+}
+
+func TestRewriteLeavesOtherResponsesUntouched(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{name: "HTML", status: http.StatusOK, contentType: "text/html", body: `<a href="http://mastodon-web:3000/">x</a>`},
+		{name: "Not found", status: http.StatusNotFound, contentType: "application/jrd+json", body: `{"subject": "http://mastodon-web:3000"}`},
+		{name: "Invalid JSON", status: http.StatusOK, contentType: "application/jrd+json", body: `{"subject": "http://mastodon-web:3000"`},
+		{name: "Large document", status: http.StatusOK, contentType: "application/jrd+json", body: strings.Repeat(" ", 2<<20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Content-Type", tt.contentType)
+				rw.WriteHeader(tt.status)
+				_, _ = io.WriteString(rw, tt.body)
+			})
+
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.Passthrough = true
+			cfg.Rewrites = []traefik_webfinger.RewriteRule{
+				{From: "http://mastodon-web:3000", To: "https://social.example.com"},
+			}
+
+			handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+			require.NoError(t, err)
+
+			recorder := getResource(handler, "acct:alice@example.com")
+			assert.Equal(t, tt.status, recorder.Code)
+			assert.Equal(t, tt.body, recorder.Body.String())
+		})
+	}
+}
+
+func TestRewriteValidation(t *testing.T) {
+	for _, rule := range []traefik_webfinger.RewriteRule{
+		{From: "mastodon-web:3000", To: "https://social.example.com"},
+		{From: "http://mastodon-web:3000", To: "https://social.example.com/path"},
+		{From: "http://mastodon-web:3000", To: ""},
+	} {
+		cfg := traefik_webfinger.CreateConfig()
+		cfg.Domain = "example.com"
+		cfg.Rewrites = []traefik_webfinger.RewriteRule{rule}
+
+		_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "test")
+		assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidRewrite, rule.From+" -> "+rule.To)
+	}
+}
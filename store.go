@@ -0,0 +1,186 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Resource layers, in order of precedence.
+const (
+	layerInline = iota
+	layerFile
+	layerDir
+	layerCount
+)
+
+// resourceStore holds the live resources, merged from the inline configuration and external sources.
+type resourceStore struct {
+	domains  []string
+	defaults responseDefaults
+
+	mu     sync.RWMutex
+	layers []map[string]resourceEntry
+	merged map[string]resourceEntry
+	// Resource each alias within the domains resolves to
+	aliases map[string]string
+	// Incremented whenever a layer is replaced
+	version uint64
+}
+
+// newResourceStore creates a store whose inline layer holds the given resources.
+func newResourceStore(inline map[string]WebFingerResponse, domains []string, defaults responseDefaults) (*resourceStore, error) {
+	store := &resourceStore{domains: domains, defaults: defaults, layers: make([]map[string]resourceEntry, layerCount)}
+	if err := store.set(layerInline, inline); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// set replaces the resources of a layer, loaded with the defaults, and rebuilds the merged view. The layer is left
+// unchanged if one of the resulting resources claims an alias of another resource.
+func (s *resourceStore) set(layer int, resources map[string]WebFingerResponse) error {
+	entries, err := s.defaults.loadAll(resources)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	layers := append([]map[string]resourceEntry{}, s.layers...)
+	layers[layer] = entries
+
+	merged := make(map[string]resourceEntry)
+
+	// Apply the layers from the lowest precedence up so earlier layers win
+	for i := len(layers) - 1; i >= 0; i-- {
+		for resource, entry := range layers[i] {
+			merged[resource] = entry
+		}
+	}
+
+	aliases, err := indexAliases(merged, s.domains)
+	if err != nil {
+		return err
+	}
+
+	s.layers = layers
+	s.merged = merged
+	s.aliases = aliases
+	s.version++
+
+	return nil
+}
+
+// owners returns the resources of the other layers and the aliases they claim, each mapped to the resource owning
+// it, along with the version of the store they were taken from.
+func (s *resourceStore) owners(except int) (map[string]string, uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	merged := make(map[string]resourceEntry)
+
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		if i == except {
+			continue
+		}
+
+		for resource, entry := range s.layers[i] {
+			merged[resource] = entry
+		}
+	}
+
+	owners, err := claimAllAliases(merged, s.domains)
+
+	return owners, s.version, err
+}
+
+// indexAliases maps the aliases within the domains to the resource claiming them. Only the records that won over
+// the other layers are indexed, and an alias claimed by two of them is rejected.
+func indexAliases(merged map[string]resourceEntry, domains []string) (map[string]string, error) {
+	owners, err := claimAllAliases(merged, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string]string, len(owners)-len(merged))
+
+	for alias, resource := range owners {
+		if alias != resource {
+			aliases[alias] = resource
+		}
+	}
+
+	return aliases, nil
+}
+
+// get returns the resource from the merged view, looking it up by its aliases if it is not a primary key.
+func (s *resourceStore) get(resource string) (resourceEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if entry, exists := s.merged[resource]; exists {
+		return entry, true
+	}
+
+	if canonical, ok := s.aliases[resource]; ok {
+		entry, exists := s.merged[canonical]
+		return entry, exists
+	}
+
+	return resourceEntry{}, false
+}
+
+// claimAllAliases maps the resources to themselves and the aliases within the domains to the resource claiming
+// them, rejecting aliases claimed by two resources.
+func claimAllAliases(resources map[string]resourceEntry, domains []string) (map[string]string, error) {
+	names := make([]string, 0, len(resources))
+	owners := make(map[string]string, len(resources))
+
+	for resource := range resources {
+		names = append(names, resource)
+		owners[resource] = resource
+	}
+
+	sort.Strings(names)
+
+	for _, resource := range names {
+		if err := claimAliases(owners, resource, resources[resource].response, domains); err != nil {
+			return nil, err
+		}
+	}
+
+	return owners, nil
+}
+
+// claimAliases records the aliases within the domains as belonging to the resource, rejecting aliases that
+// another resource already claims. Owners must be seeded with the resource keys: an alias that is itself a resource
+// is left to that resource, so resources may list each other as aliases.
+func claimAliases(owners map[string]string, resource string, response WebFingerResponse, domains []string) error {
+	var claimed []string
+
+	for _, alias := range response.Aliases {
+		if _, ok := matchDomain(alias, domains); !ok || alias == resource {
+			continue
+		}
+
+		owner, ok := owners[alias]
+		if ok && owner == alias {
+			continue
+		}
+
+		if ok && owner != resource {
+			return fmt.Errorf("%w: %s claimed by %s and %s", ErrDuplicateAlias, alias, owner, resource)
+		}
+
+		claimed = append(claimed, alias)
+	}
+
+	for _, alias := range claimed {
+		owners[alias] = resource
+	}
+
+	return nil
+}
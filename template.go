@@ -0,0 +1,304 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// userVariable is the placeholder capturing the user name in resource templates.
+const userVariable = "user"
+
+// subdomainVariable is the placeholder capturing a subdomain label in resource templates.
+const subdomainVariable = "subdomain"
+
+// clientVariable is the link template placeholder that clients fill in with the resource (RFC 6415 section 4.2),
+// which rendering never replaces.
+const clientVariable = "uri"
+
+// userPattern restricts captured user names to characters that are safe to substitute into URIs.
+const userPattern = `(?P<user>[A-Za-z0-9._~+-]+)`
+
+// subdomainPattern captures a single DNS label.
+const subdomainPattern = `(?P<subdomain>[A-Za-z0-9-]+)`
+
+// resourceTemplate is a compiled entry of Config.ResourceTemplates.
+type resourceTemplate struct {
+	pattern string
+	matcher *regexp.Regexp
+	entry   resourceEntry
+}
+
+// userFilter restricts the user names resource templates resolve.
+type userFilter struct {
+	allowed map[string]struct{}
+	denied  map[string]struct{}
+}
+
+// newResourceTemplates validates and compiles the resource templates, ordered by pattern, and loads their responses
+// with the defaults.
+func newResourceTemplates(templates map[string]WebFingerResponse, domains []string, defaults responseDefaults) ([]resourceTemplate, error) {
+	patterns := make([]string, 0, len(templates))
+	for pattern := range templates {
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Strings(patterns)
+
+	compiled := make([]resourceTemplate, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		response := templates[pattern]
+
+		matcher, err := compileTemplatePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := matchDomain(templateSample(pattern), domains); !ok {
+			return nil, fmt.Errorf("%w: %s for domains %s", ErrResourceDomainMatch, pattern, strings.Join(domains, ", "))
+		}
+
+		if err := validateResponse(pattern, response); err != nil {
+			return nil, err
+		}
+
+		values := append([]string{response.Subject}, response.Aliases...)
+		for _, link := range response.Links {
+			values = append(values, link.Href)
+		}
+
+		for _, value := range values {
+			variables, err := templateVariables(value)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, variable := range variables {
+				if variable == subdomainVariable && matcher.SubexpIndex(subdomainVariable) < 0 {
+					return nil, fmt.Errorf("%w: %s: {%s} is not captured by the pattern", ErrInvalidTemplate, pattern, variable)
+				}
+			}
+		}
+
+		// Link templates may also hold placeholders for the client, which are left alone
+		for _, link := range response.Links {
+			variables, err := placeholders(link.Template)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, variable := range variables {
+				if variable == subdomainVariable && matcher.SubexpIndex(subdomainVariable) < 0 {
+					return nil, fmt.Errorf("%w: %s: {%s} is not captured by the pattern", ErrInvalidTemplate, pattern, variable)
+				}
+			}
+		}
+
+		if err := defaults.profiles.validate(pattern, response); err != nil {
+			return nil, err
+		}
+
+		entry, err := defaults.load(pattern, response)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled = append(compiled, resourceTemplate{pattern: pattern, matcher: matcher, entry: entry})
+	}
+
+	return compiled, nil
+}
+
+// compileTemplatePattern turns a pattern such as acct:{user}@example.com or acct:{user}@{subdomain}.example.com
+// into an anchored regular expression. Its scheme and host are folded to lower case, so resources must be folded
+// with foldResourceHost before they are matched.
+func compileTemplatePattern(pattern string) (*regexp.Regexp, error) {
+	variables, err := templateVariables(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(variables))
+	for _, variable := range variables {
+		counts[variable]++
+	}
+
+	if counts[userVariable] != 1 || counts[subdomainVariable] > 1 {
+		return nil, fmt.Errorf("%w: %s: exactly one {%s} and at most one {%s} placeholder are allowed",
+			ErrInvalidTemplate, pattern, userVariable, subdomainVariable)
+	}
+
+	expression := strings.NewReplacer(
+		regexp.QuoteMeta("{"+userVariable+"}"), userPattern,
+		regexp.QuoteMeta("{"+subdomainVariable+"}"), subdomainPattern,
+	).Replace(regexp.QuoteMeta(foldResourceHost(pattern)))
+
+	return regexp.Compile("^" + expression + "$")
+}
+
+// foldResourceHost lowers the case of the scheme and host of a resource, which are case-insensitive like in domain
+// matching, leaving user names and paths alone.
+func foldResourceHost(resource string) string {
+	colon := strings.Index(resource, ":")
+	if colon < 0 {
+		return resource
+	}
+
+	scheme, rest := strings.ToLower(resource[:colon+1]), resource[colon+1:]
+
+	// The host ends the authority of hierarchical URIs, and follows the last @ of opaque ones such as acct:
+	start, end := 0, strings.IndexAny(rest, "?#")
+	if strings.HasPrefix(rest, "//") {
+		start = 2
+		end = strings.IndexAny(rest[start:], "/?#")
+		if end >= 0 {
+			end += start
+		}
+	}
+
+	if end < 0 {
+		end = len(rest)
+	}
+
+	if at := strings.LastIndex(rest[start:end], "@"); at >= 0 {
+		start += at + 1
+	} else if start == 0 {
+		return scheme + rest
+	}
+
+	return scheme + rest[:start] + strings.ToLower(rest[start:end]) + rest[end:]
+}
+
+// templateSample returns a resource matching the pattern, used to check which domain the pattern belongs to.
+func templateSample(pattern string) string {
+	return strings.NewReplacer(
+		"{"+userVariable+"}", userVariable,
+		"{"+subdomainVariable+"}", subdomainVariable,
+	).Replace(pattern)
+}
+
+// templateVariables returns the placeholders used in the value, rejecting malformed or unknown ones.
+func templateVariables(value string) ([]string, error) {
+	variables, err := placeholders(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range variables {
+		if name != userVariable && name != subdomainVariable {
+			return nil, fmt.Errorf("%w: unknown placeholder {%s} in %q", ErrInvalidTemplate, name, value)
+		}
+	}
+
+	return variables, nil
+}
+
+// placeholders returns the names of the {name} placeholders in the value, rejecting malformed ones.
+func placeholders(value string) ([]string, error) {
+	var variables []string
+
+	for rest := value; ; {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			return variables, nil
+		}
+
+		if rest[start] == '}' {
+			return nil, fmt.Errorf("%w: unexpected '}' in %q", ErrInvalidTemplate, value)
+		}
+
+		end := strings.IndexAny(rest[start+1:], "{}")
+		if end < 0 || rest[start+1+end] != '}' {
+			return nil, fmt.Errorf("%w: unterminated placeholder in %q", ErrInvalidTemplate, value)
+		}
+
+		name := rest[start+1 : start+1+end]
+		if name == "" {
+			return nil, fmt.Errorf("%w: empty placeholder in %q", ErrInvalidTemplate, value)
+		}
+
+		variables = append(variables, name)
+		rest = rest[start+end+2:]
+	}
+}
+
+// render returns the response for the resource if it matches the template pattern.
+func (t resourceTemplate) render(resource string, users userFilter) (resourceEntry, bool) {
+	match := t.matcher.FindStringSubmatch(foldResourceHost(resource))
+	if match == nil {
+		return resourceEntry{}, false
+	}
+
+	user := match[t.matcher.SubexpIndex(userVariable)]
+	if !users.permits(user) {
+		return resourceEntry{}, false
+	}
+
+	subdomain := ""
+	if index := t.matcher.SubexpIndex(subdomainVariable); index >= 0 {
+		subdomain = strings.ToLower(match[index])
+	}
+
+	replacer := strings.NewReplacer("{"+userVariable+"}", user, "{"+subdomainVariable+"}", subdomain)
+
+	return t.entry.render(replacer), true
+}
+
+// renderResponse returns a copy of the response with the placeholders of the subject, aliases and link hrefs replaced.
+func renderResponse(template WebFingerResponse, replacer *strings.Replacer) WebFingerResponse {
+	response := WebFingerResponse{
+		Subject:    replacer.Replace(template.Subject),
+		Aliases:    make([]string, 0, len(template.Aliases)),
+		Properties: template.Properties,
+		Links:      make([]WebFingerLink, 0, len(template.Links)),
+	}
+
+	for _, alias := range template.Aliases {
+		response.Aliases = append(response.Aliases, replacer.Replace(alias))
+	}
+
+	for _, link := range template.Links {
+		link.Href = replacer.Replace(link.Href)
+		link.Template = replacer.Replace(link.Template)
+		response.Links = append(response.Links, link)
+	}
+
+	return response
+}
+
+// newUserFilter builds a case-insensitive filter from the allow and deny lists.
+func newUserFilter(allowed, denied []string) userFilter {
+	filter := userFilter{
+		allowed: make(map[string]struct{}, len(allowed)),
+		denied:  make(map[string]struct{}, len(denied)),
+	}
+
+	for _, user := range allowed {
+		filter.allowed[strings.ToLower(user)] = struct{}{}
+	}
+
+	for _, user := range denied {
+		filter.denied[strings.ToLower(user)] = struct{}{}
+	}
+
+	return filter
+}
+
+// permits reports whether resource templates may resolve the user name.
+func (f userFilter) permits(user string) bool {
+	user = strings.ToLower(user)
+
+	if _, ok := f.denied[user]; ok {
+		return false
+	}
+
+	if len(f.allowed) == 0 {
+		return true
+	}
+
+	_, ok := f.allowed[user]
+
+	return ok
+}
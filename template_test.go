@@ -0,0 +1,168 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceTemplates(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Href: "https://example.com/custom/alice"},
+			},
+		},
+	}
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@example.com": {
+			Subject: "acct:{user}@example.com",
+			Aliases: []string{"https://social.example.com/@{user}"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Type: "application/activity+json", Href: "https://social.example.com/users/{user}"},
+			},
+		},
+	}
+	cfg.DeniedUsers = []string{"root"}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	get := func(resource string) (int, traefik_webfinger.WebFingerResponse) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+resource, nil))
+
+		var response traefik_webfinger.WebFingerResponse
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		}
+
+		return recorder.Code, response
+	}
+
+	// Rendered from the template
+	code, response := get("acct:bob@example.com")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "acct:bob@example.com", response.Subject)
+	assert.Equal(t, []string{"https://social.example.com/@bob"}, response.Aliases)
+	assert.Equal(t, "https://social.example.com/users/bob", response.Links[0].Href)
+
+	// Hosts are matched case-insensitively, like domains, while the user name keeps its case
+	code, response = get("ACCT:Bob@Example.COM")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "acct:Bob@example.com", response.Subject)
+
+	// Explicit resources take precedence
+	code, response = get("acct:alice@example.com")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://example.com/custom/alice", response.Links[0].Href)
+
+	// Denied users and unsafe user names are not resolved
+	code, _ = get("acct:root@example.com")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = get("acct:a%2Fb@example.com")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = get("acct:bob@example.org")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestResourceTemplatesAllowedUsers(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@example.com": {Subject: "acct:{user}@example.com"},
+	}
+	cfg.AllowedUsers = []string{"Alice", "bob"}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	for resource, expectedCode := range map[string]int{
+		"acct:alice@example.com": http.StatusOK,
+		"acct:bob@example.com":   http.StatusOK,
+		"acct:carol@example.com": http.StatusNotFound,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+resource, nil))
+		assert.Equal(t, expectedCode, recorder.Code, resource)
+	}
+}
+
+func TestResourceTemplatesValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]traefik_webfinger.WebFingerResponse
+		expected  error
+	}{
+		{
+			name:      "Missing placeholder",
+			templates: map[string]traefik_webfinger.WebFingerResponse{"acct:bob@example.com": {Subject: "acct:bob@example.com"}},
+			expected:  traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name: "Repeated placeholder",
+			templates: map[string]traefik_webfinger.WebFingerResponse{
+				"acct:{user}.{user}@example.com": {Subject: "acct:{user}@example.com"},
+			},
+			expected: traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name:      "Unknown placeholder",
+			templates: map[string]traefik_webfinger.WebFingerResponse{"acct:{name}@example.com": {Subject: "acct:{name}@example.com"}},
+			expected:  traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name:      "Unterminated placeholder",
+			templates: map[string]traefik_webfinger.WebFingerResponse{"acct:{user}@example.com": {Subject: "acct:{user@example.com"}},
+			expected:  traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name: "Malformed href",
+			templates: map[string]traefik_webfinger.WebFingerResponse{
+				"acct:{user}@example.com": {
+					Subject: "acct:{user}@example.com",
+					Links:   []traefik_webfinger.WebFingerLink{{Rel: "self", Href: "https://example.com/users/user}"}},
+				},
+			},
+			expected: traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name:      "Other domain",
+			templates: map[string]traefik_webfinger.WebFingerResponse{"acct:{user}@example.org": {Subject: "acct:{user}@example.org"}},
+			expected:  traefik_webfinger.ErrResourceDomainMatch,
+		},
+		{
+			name:      "Missing subject",
+			templates: map[string]traefik_webfinger.WebFingerResponse{"acct:{user}@example.com": {}},
+			expected:  traefik_webfinger.ErrSubjectRequired,
+		},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.ResourceTemplates = tt.templates
+
+			_, err := traefik_webfinger.New(context.Background(), next, cfg, "test")
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
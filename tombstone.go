@@ -0,0 +1,111 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// movedToRel is the relation of the link pointing at the new identity of a tombstoned account.
+const movedToRel = "https://www.w3.org/ns/activitystreams#movedTo"
+
+// Tombstone keeps answering for a removed resource with 410 Gone until it expires.
+type Tombstone struct {
+	// New identity of the account, such as acct:alice@social.example.net
+	MovedTo string `json:"movedTo,omitempty" yaml:"movedTo"`
+	// RFC 3339 time or date after which the resource is answered like any unknown one
+	Expires string `json:"expires,omitempty" yaml:"expires"`
+}
+
+// tombstone is a validated Tombstone.
+type tombstone struct {
+	movedTo string
+	// Zero when the tombstone never expires
+	expires time.Time
+}
+
+// newTombstones validates the tombstones, which must belong to the domains and not shadow configured resources.
+func newTombstones(config map[string]Tombstone, domains []string, resources map[string]WebFingerResponse) (map[string]tombstone, error) {
+	names := make([]string, 0, len(config))
+	for resource := range config {
+		names = append(names, resource)
+	}
+
+	sort.Strings(names)
+
+	tombstones := make(map[string]tombstone, len(config))
+
+	for _, resource := range names {
+		entry := config[resource]
+
+		if _, ok := matchDomain(resource, domains); !ok {
+			return nil, fmt.Errorf("%w: %s for domains %s", ErrResourceDomainMatch, resource, strings.Join(domains, ", "))
+		}
+
+		if _, ok := resources[resource]; ok {
+			return nil, fmt.Errorf("%w: %s is both a resource and a tombstone", ErrInvalidTombstone, resource)
+		}
+
+		if entry.MovedTo != "" {
+			if parsed, err := url.Parse(entry.MovedTo); err != nil || parsed.Scheme == "" {
+				return nil, fmt.Errorf("%w: %s: movedTo %q is not a URI", ErrInvalidTombstone, resource, entry.MovedTo)
+			}
+		}
+
+		expires, err := parseTimestamp(entry.Expires)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: expires %q", ErrInvalidTombstone, resource, entry.Expires)
+		}
+
+		tombstones[resource] = tombstone{movedTo: entry.MovedTo, expires: expires}
+	}
+
+	return tombstones, nil
+}
+
+// active reports whether the tombstone has not expired yet.
+func (t tombstone) active(now time.Time) bool {
+	return t.expires.IsZero() || now.Before(t.expires)
+}
+
+// response returns the document served with 410 Gone, pointing at the new identity.
+func (t tombstone) response(resource string) WebFingerResponse {
+	return WebFingerResponse{
+		Subject: resource,
+		Aliases: []string{t.movedTo},
+		Links:   []WebFingerLink{{Rel: movedToRel, Href: t.movedTo}},
+	}
+}
+
+// serveTombstone answers with 410 Gone if the resource has an active tombstone, and reports whether it did.
+// Tombstones take precedence over templates, rules and the upstream, but not over resources that a resources file
+// or directory defines again.
+func (w *WebFinger) serveTombstone(responseWriter http.ResponseWriter, req *http.Request, resource string) bool {
+	now := w.clock()
+
+	entry, ok := w.tombstones[resource]
+	if !ok || !entry.active(now) {
+		return false
+	}
+
+	if _, defined := w.resources.get(resource); defined {
+		return false
+	}
+
+	// Caches must not keep the answer once the tombstone expires
+	setCacheHeaders(responseWriter.Header(), now, entry.expires)
+
+	if entry.movedTo == "" {
+		w.cors.setHeaders(responseWriter.Header(), req)
+		http.Error(responseWriter, "Resource gone", http.StatusGone)
+
+		return true
+	}
+
+	w.writeResponse(responseWriter, req, entry.response(resource), http.StatusGone)
+
+	return true
+}
@@ -0,0 +1,124 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTombstones(t *testing.T) {
+	resourcesFile := filepath.Join(t.TempDir(), "resources.json")
+	writeResourcesFile(t, resourcesFile, `{"acct:carol@example.com": {"subject": "acct:carol@example.com"}}`, time.Now())
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = resourcesFile
+	cfg.Tombstones = map[string]traefik_webfinger.Tombstone{
+		"acct:alice@example.com": {MovedTo: "acct:alice@social.example.net", Expires: time.Now().Add(time.Hour).Format(time.RFC3339)},
+		"acct:bob@example.com":   {},
+		"acct:carol@example.com": {},
+		"acct:dave@example.com":  {MovedTo: "acct:dave@social.example.net", Expires: "2001-01-01"},
+	}
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@example.com": {Subject: "acct:{user}@example.com"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// Tombstones with a new identity point at it
+	recorder := getResource(handler, "acct:alice@example.com")
+	require.Equal(t, http.StatusGone, recorder.Code)
+	assert.Equal(t, "application/jrd+json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, traefik_webfinger.WebFingerResponse{
+		Subject: "acct:alice@example.com",
+		Aliases: []string{"acct:alice@social.example.net"},
+		Links: []traefik_webfinger.WebFingerLink{
+			{Rel: "https://www.w3.org/ns/activitystreams#movedTo", Href: "acct:alice@social.example.net"},
+		},
+	}, response)
+
+	// Tombstones without one are plain 410 answers, taking precedence over templates
+	assert.Equal(t, http.StatusGone, statusOf(handler, "acct:bob@example.com"))
+
+	// Resources defined again by a resources file are served
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:carol@example.com"))
+
+	// Expired tombstones are ignored
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:dave@example.com"))
+
+	// The XRD form carries the same status
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:alice@example.com", nil)
+	req.Header.Set("Accept", "application/xrd+xml")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusGone, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "<Alias>acct:alice@social.example.net</Alias>")
+}
+
+func TestExpiredTombstoneNotFound(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Tombstones = map[string]traefik_webfinger.Tombstone{
+		"acct:alice@example.com": {MovedTo: "acct:alice@social.example.net", Expires: "2001-01-01T12:00:00Z"},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:alice@example.com"))
+}
+
+func TestTombstoneValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  string
+		tombstone traefik_webfinger.Tombstone
+		expectErr error
+	}{
+		{name: "Configured resource", resource: "acct:alice@example.com", expectErr: traefik_webfinger.ErrInvalidTombstone},
+		{name: "Other domain", resource: "acct:bob@example.org", expectErr: traefik_webfinger.ErrResourceDomainMatch},
+		{
+			name:      "Invalid expiry",
+			resource:  "acct:bob@example.com",
+			tombstone: traefik_webfinger.Tombstone{Expires: "next week"},
+			expectErr: traefik_webfinger.ErrInvalidTombstone,
+		},
+		{
+			name:      "Relative new identity",
+			resource:  "acct:bob@example.com",
+			tombstone: traefik_webfinger.Tombstone{MovedTo: "bob@social.example.net"},
+			expectErr: traefik_webfinger.ErrInvalidTombstone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+				"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+			}
+			cfg.Tombstones = map[string]traefik_webfinger.Tombstone{tt.resource: tt.tombstone}
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, tt.expectErr)
+		})
+	}
+}
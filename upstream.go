@@ -0,0 +1,246 @@
+package traefik_webfinger
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	upstreamPlaceholder      = "{resource}"
+	defaultUpstreamTimeout   = 5 * time.Second
+	defaultUpstreamCacheTTL  = 5 * time.Minute
+	defaultUpstreamCacheSize = 1000
+	// maxUpstreamBodySize bounds the JRD documents read from the upstream
+	maxUpstreamBodySize = 1 << 20
+)
+
+// UpstreamConfig defines an HTTP directory queried for resources that are not configured.
+type UpstreamConfig struct {
+	// URL template, {resource} is replaced with the query-escaped resource
+	URL string `json:"url,omitempty" yaml:"url"`
+	// Timeout of upstream requests, 5s by default
+	Timeout string `json:"timeout,omitempty" yaml:"timeout"`
+	// How long upstream results are cached, 5m by default
+	CacheTTL string `json:"cacheTTL,omitempty" yaml:"cacheTTL"`
+	// Maximum number of cached results, 1000 by default
+	CacheSize int `json:"cacheSize,omitempty" yaml:"cacheSize"`
+}
+
+// upstreamResult is a cached upstream answer, a nil entry meaning the resource does not exist.
+type upstreamResult struct {
+	resource string
+	entry    *resourceEntry
+	expires  time.Time
+}
+
+// upstream resolves resources through the configured HTTP directory.
+type upstream struct {
+	template string
+	defaults responseDefaults
+	client   *http.Client
+	ttl      time.Duration
+	size     int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// Least recently used results are at the back
+	order *list.List
+}
+
+// newUpstream validates the upstream configuration.
+func newUpstream(config UpstreamConfig, defaults responseDefaults) (*upstream, error) {
+	parsed, err := url.Parse(strings.ReplaceAll(config.URL, upstreamPlaceholder, "resource"))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		!strings.Contains(config.URL, upstreamPlaceholder) {
+		return nil, fmt.Errorf("%w: url %s", ErrInvalidUpstream, config.URL)
+	}
+
+	timeout, err := parseUpstreamDuration(config.Timeout, defaultUpstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := parseUpstreamDuration(config.CacheTTL, defaultUpstreamCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	size := config.CacheSize
+	if size < 0 {
+		return nil, fmt.Errorf("%w: cache size %d", ErrInvalidUpstream, size)
+	}
+
+	if size == 0 {
+		size = defaultUpstreamCacheSize
+	}
+
+	return &upstream{
+		template: config.URL,
+		defaults: defaults,
+		client:   &http.Client{Timeout: timeout},
+		ttl:      ttl,
+		size:     size,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}, nil
+}
+
+// parseUpstreamDuration parses an optional positive duration.
+func parseUpstreamDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%w: duration %s", ErrInvalidUpstream, value)
+	}
+
+	return duration, nil
+}
+
+// resolve returns the upstream response for the resource, using the cache when possible.
+func (u *upstream) resolve(ctx context.Context, resource string) (resourceEntry, bool, error) {
+	if result, ok := u.cached(resource); ok {
+		if result == nil {
+			return resourceEntry{}, false, nil
+		}
+
+		return *result, true, nil
+	}
+
+	entry, err := u.fetch(ctx, resource)
+	if err != nil {
+		return resourceEntry{}, false, err
+	}
+
+	u.store(resource, entry)
+
+	if entry == nil {
+		return resourceEntry{}, false, nil
+	}
+
+	return *entry, true, nil
+}
+
+// fetch queries the upstream and loads its response with the defaults. A nil entry without error means the upstream
+// does not know the resource.
+func (u *upstream) fetch(ctx context.Context, resource string) (*resourceEntry, error) {
+	target := strings.ReplaceAll(u.template, upstreamPlaceholder, url.QueryEscape(resource))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamUnavailable, err.Error())
+	}
+
+	req.Header.Set("Accept", "application/jrd+json")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fmt.Errorf("%w: %s", ErrUpstreamTimeout, err.Error())
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: status %d", ErrUpstreamUnavailable, resp.StatusCode)
+	}
+
+	var response WebFingerResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxUpstreamBodySize)).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamInvalid, err.Error())
+	}
+
+	if err := validateResponse(resource, response); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamInvalid, err.Error())
+	}
+
+	if err := u.defaults.profiles.validate(resource, response); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamInvalid, err.Error())
+	}
+
+	entry, err := u.defaults.load(resource, response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamInvalid, err.Error())
+	}
+
+	return &entry, nil
+}
+
+// cached returns an unexpired cached result and marks it as recently used.
+func (u *upstream) cached(resource string) (*resourceEntry, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	element, ok := u.entries[resource]
+	if !ok {
+		return nil, false
+	}
+
+	result, _ := element.Value.(*upstreamResult)
+	if time.Now().After(result.expires) {
+		u.order.Remove(element)
+		delete(u.entries, resource)
+
+		return nil, false
+	}
+
+	u.order.MoveToFront(element)
+
+	return result.entry, true
+}
+
+// store caches a result, evicting the least recently used one when the cache is full.
+func (u *upstream) store(resource string, entry *resourceEntry) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	result := &upstreamResult{resource: resource, entry: entry, expires: time.Now().Add(u.ttl)}
+
+	if element, ok := u.entries[resource]; ok {
+		element.Value = result
+		u.order.MoveToFront(element)
+
+		return
+	}
+
+	if u.order.Len() >= u.size {
+		oldest := u.order.Back()
+		if evicted, ok := oldest.Value.(*upstreamResult); ok {
+			delete(u.entries, evicted.resource)
+		}
+
+		u.order.Remove(oldest)
+	}
+
+	u.entries[resource] = u.order.PushFront(result)
+}
+
+// upstreamStatus maps upstream failures to the status returned to WebFinger clients.
+func upstreamStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUpstreamTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrUpstreamInvalid):
+		return http.StatusBadGateway
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
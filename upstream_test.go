@@ -0,0 +1,141 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstream(t *testing.T) {
+	var calls int32
+
+	directory := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		switch req.URL.Query().Get("resource") {
+		case "acct:alice@example.com":
+			rw.Header().Set("Content-Type", "application/jrd+json")
+			_ = json.NewEncoder(rw).Encode(traefik_webfinger.WebFingerResponse{
+				Subject: "acct:alice@example.com",
+				Links:   []traefik_webfinger.WebFingerLink{{Rel: "self", Href: "https://example.com/users/alice"}},
+			})
+		case "acct:invalid@example.com":
+			_, _ = rw.Write([]byte(`{"links": [{"rel": "self"}]}`))
+		case "acct:broken@example.com":
+			http.Error(rw, "database connection refused", http.StatusInternalServerError)
+		case "acct:slow@example.com":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer directory.Close()
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Upstream = traefik_webfinger.UpstreamConfig{
+		URL:     directory.URL + "/jrd?resource={resource}",
+		Timeout: "50ms",
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// Resolved and cached
+	recorder := getResource(handler, "acct:alice@example.com")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "https://example.com/users/alice")
+
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:alice@example.com"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Unknown resources are cached too
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:bob@example.com"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:bob@example.com"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Resources of other domains are never sent upstream
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:alice@example.org"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Failures are mapped without leaking upstream details
+	recorder = getResource(handler, "acct:broken@example.com")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "database")
+
+	assert.Equal(t, http.StatusBadGateway, statusOf(handler, "acct:invalid@example.com"))
+	assert.Equal(t, http.StatusGatewayTimeout, statusOf(handler, "acct:slow@example.com"))
+}
+
+func TestUpstreamCacheBounds(t *testing.T) {
+	var calls int32
+
+	directory := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_ = json.NewEncoder(rw).Encode(traefik_webfinger.WebFingerResponse{Subject: req.URL.Query().Get("resource")})
+	}))
+	defer directory.Close()
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Upstream = traefik_webfinger.UpstreamConfig{
+		URL:       directory.URL + "/jrd?resource={resource}",
+		CacheTTL:  "100ms",
+		CacheSize: 1,
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(context.Background(), next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// A single entry fits: the second resource evicts the first one
+	statusOf(handler, "acct:alice@example.com")
+	statusOf(handler, "acct:bob@example.com")
+	statusOf(handler, "acct:alice@example.com")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	statusOf(handler, "acct:alice@example.com")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// Expired entries are fetched again
+	time.Sleep(150 * time.Millisecond)
+	statusOf(handler, "acct:alice@example.com")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestUpstreamValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream traefik_webfinger.UpstreamConfig
+	}{
+		{name: "Missing placeholder", upstream: traefik_webfinger.UpstreamConfig{URL: "http://directory.internal/jrd"}},
+		{name: "Unsupported scheme", upstream: traefik_webfinger.UpstreamConfig{URL: "ftp://directory.internal/{resource}"}},
+		{name: "Invalid timeout", upstream: traefik_webfinger.UpstreamConfig{URL: "http://directory.internal/{resource}", Timeout: "-1s"}},
+		{name: "Invalid cache TTL", upstream: traefik_webfinger.UpstreamConfig{URL: "http://directory.internal/{resource}", CacheTTL: "a while"}},
+		{name: "Negative cache size", upstream: traefik_webfinger.UpstreamConfig{URL: "http://directory.internal/{resource}", CacheSize: -1}},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			cfg.Upstream = tt.upstream
+
+			_, err := traefik_webfinger.New(context.Background(), next, cfg, "test")
+			assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidUpstream)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validityWindow is the period in which a resource or link is served, from notBefore until just before notAfter.
+// Zero bounds are open.
+type validityWindow struct {
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// parseTimestamp parses an optional RFC 3339 time, or a date meaning midnight UTC.
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+// parseValidityWindow parses the notBefore and notAfter bounds of a resource or link.
+func parseValidityWindow(owner, notBefore, notAfter string) (validityWindow, error) {
+	start, err := parseTimestamp(notBefore)
+	if err != nil {
+		return validityWindow{}, fmt.Errorf("%w: %s: notBefore %q", ErrInvalidValidity, owner, notBefore)
+	}
+
+	end, err := parseTimestamp(notAfter)
+	if err != nil {
+		return validityWindow{}, fmt.Errorf("%w: %s: notAfter %q", ErrInvalidValidity, owner, notAfter)
+	}
+
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return validityWindow{}, fmt.Errorf("%w: %s: notAfter %s is not after notBefore %s", ErrInvalidValidity, owner, notAfter, notBefore)
+	}
+
+	return validityWindow{notBefore: start, notAfter: end}, nil
+}
+
+// validateValidity checks the validity window of a resource.
+func validateValidity(resource string, response WebFingerResponse) error {
+	_, err := parseValidityWindow(resource, response.NotBefore, response.NotAfter)
+
+	return err
+}
+
+// validateLinkValidity checks the validity windows of links.
+func validateLinkValidity(owner string, links []WebFingerLink) error {
+	for _, link := range links {
+		if _, err := parseValidityWindow(owner+" link "+link.Rel, link.NotBefore, link.NotAfter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// contains reports whether the window includes the time.
+func (v validityWindow) contains(now time.Time) bool {
+	return (v.notBefore.IsZero() || !now.Before(v.notBefore)) && (v.notAfter.IsZero() || now.Before(v.notAfter))
+}
+
+// nextChange returns the first bound after the time, or zero if there is none.
+func (v validityWindow) nextChange(now time.Time) time.Time {
+	switch {
+	case now.Before(v.notBefore):
+		return v.notBefore
+	case now.Before(v.notAfter):
+		return v.notAfter
+	default:
+		return time.Time{}
+	}
+}
+
+// resourceEntry is a loaded resource: the response to serve, along with the validity windows of the resource and
+// of each of its links, which are parsed once when the resource is loaded.
+type resourceEntry struct {
+	response    WebFingerResponse
+	window      validityWindow
+	linkWindows []validityWindow
+}
+
+// newResourceEntry parses the validity windows of the resource and its links. They are dropped from the response, as
+// they are not part of the served document.
+func newResourceEntry(resource string, response WebFingerResponse) (resourceEntry, error) {
+	window, err := parseValidityWindow(resource, response.NotBefore, response.NotAfter)
+	if err != nil {
+		return resourceEntry{}, err
+	}
+
+	entry := resourceEntry{window: window, linkWindows: make([]validityWindow, len(response.Links))}
+
+	links := make([]WebFingerLink, len(response.Links))
+
+	for i, link := range response.Links {
+		entry.linkWindows[i], err = parseValidityWindow(resource+" link "+link.Rel, link.NotBefore, link.NotAfter)
+		if err != nil {
+			return resourceEntry{}, err
+		}
+
+		link.NotBefore, link.NotAfter = "", ""
+		links[i] = link
+	}
+
+	if response.Links != nil {
+		response.Links = links
+	}
+
+	response.NotBefore, response.NotAfter = "", ""
+	entry.response = response
+
+	return entry, nil
+}
+
+// render returns a copy of the entry with the placeholders of the response replaced. Links keep their windows, as
+// rendering neither adds nor removes any.
+func (e resourceEntry) render(replacer *strings.Replacer) resourceEntry {
+	e.response = renderResponse(e.response, replacer)
+
+	return e
+}
+
+// applyValidity returns the response of the entry without the links outside their validity window, and the time at
+// which the served document changes next, zero if it never does. It reports false when the resource itself is
+// outside its window, along with the time at which the window opens, if it is still ahead.
+func applyValidity(entry resourceEntry, now time.Time) (WebFingerResponse, time.Time, bool) {
+	if !entry.window.contains(now) {
+		return WebFingerResponse{}, entry.window.nextChange(now), false
+	}
+
+	response := entry.response
+	links, changes := entry.activeLinks(now)
+
+	if response.Links != nil {
+		response.Links = links
+	}
+
+	return response, earliest(changes, entry.window.nextChange(now)), true
+}
+
+// activeLinks returns the links of the entry inside their validity window, and the time at which one of them
+// appears or disappears next, zero if none ever does.
+func (e resourceEntry) activeLinks(now time.Time) ([]WebFingerLink, time.Time) {
+	var changes time.Time
+
+	links := make([]WebFingerLink, 0, len(e.response.Links))
+
+	for i, link := range e.response.Links {
+		window := e.linkWindows[i]
+		changes = earliest(changes, window.nextChange(now))
+
+		if window.contains(now) {
+			links = append(links, link)
+		}
+	}
+
+	return links, changes
+}
+
+// earliest returns the earlier of two times, ignoring zero ones.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+
+	return a
+}
+
+// setCacheHeaders limits how long caches keep a response that changes at the given time.
+func setCacheHeaders(header http.Header, now, changes time.Time) {
+	if changes.IsZero() {
+		return
+	}
+
+	maxAge := int64(math.Ceil(changes.Sub(now).Seconds()))
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	header.Set("Cache-Control", "max-age="+strconv.FormatInt(maxAge, 10))
+	header.Set("Expires", changes.UTC().Format(http.TimeFormat))
+}
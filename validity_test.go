@@ -0,0 +1,277 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a settable clock for handlers under test.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestValidityWindows(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:contractor@example.com": {
+			Subject:   "acct:contractor@example.com",
+			NotBefore: "2030-03-01",
+			NotAfter:  "2030-06-01T00:00:00Z",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Href: "https://example.com/users/contractor"},
+				{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/event", NotAfter: "2030-03-01T12:00:00Z"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/avatar.png", NotBefore: "2030-04-01T00:00:00+02:00"},
+			},
+		},
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+	cfg.Tombstones = map[string]traefik_webfinger.Tombstone{
+		"acct:bob@example.com": {Expires: "2030-03-01"},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	clock := &fakeClock{now: time.Date(2030, 2, 28, 23, 0, 0, 0, time.UTC)}
+	traefik_webfinger.SetClock(handler, clock.Now)
+
+	get := func(resource string) (*traefik_webfinger.WebFingerResponse, http.Header) {
+		recorder := getResource(handler, resource)
+		if recorder.Code != http.StatusOK {
+			return nil, recorder.Header()
+		}
+
+		assert.NotContains(t, recorder.Body.String(), "notBefore")
+		assert.NotContains(t, recorder.Body.String(), "notAfter")
+
+		var response traefik_webfinger.WebFingerResponse
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+		return &response, recorder.Header()
+	}
+
+	rels := func(response *traefik_webfinger.WebFingerResponse) []string {
+		var names []string
+		for _, link := range response.Links {
+			names = append(names, link.Rel)
+		}
+
+		return names
+	}
+
+	// Before the window the resource is unknown, while the tombstone is still active, and neither answer outlives
+	// the change
+	response, header := get("acct:contractor@example.com")
+	assert.Nil(t, response)
+	assert.Equal(t, "max-age=3600", header.Get("Cache-Control"))
+	assert.Equal(t, "Fri, 01 Mar 2030 00:00:00 GMT", header.Get("Expires"))
+
+	recorder := getResource(handler, "acct:bob@example.com")
+	assert.Equal(t, http.StatusGone, recorder.Code)
+	assert.Equal(t, "max-age=3600", recorder.Header().Get("Cache-Control"))
+	assert.Equal(t, "Fri, 01 Mar 2030 00:00:00 GMT", recorder.Header().Get("Expires"))
+
+	// In the window, caching is bounded by the next link change
+	clock.now = time.Date(2030, 3, 1, 11, 0, 0, 0, time.UTC)
+	response, header = get("acct:contractor@example.com")
+	require.NotNil(t, response)
+	assert.Equal(t, []string{"self", "http://webfinger.net/rel/profile-page"}, rels(response))
+	assert.Equal(t, "max-age=3600", header.Get("Cache-Control"))
+	assert.Equal(t, "Fri, 01 Mar 2030 12:00:00 GMT", header.Get("Expires"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:bob@example.com"))
+
+	// Expired links are dropped, and caching is bounded by the link that appears next
+	clock.now = time.Date(2030, 3, 1, 12, 0, 0, 0, time.UTC)
+	response, header = get("acct:contractor@example.com")
+	require.NotNil(t, response)
+	assert.Equal(t, []string{"self"}, rels(response))
+	assert.Equal(t, "Sun, 31 Mar 2030 22:00:00 GMT", header.Get("Expires"))
+
+	// Then by the end of the resource window
+	clock.now = time.Date(2030, 5, 31, 23, 59, 30, 0, time.UTC)
+	response, header = get("acct:contractor@example.com")
+	require.NotNil(t, response)
+	assert.Equal(t, []string{"self", "http://webfinger.net/rel/avatar"}, rels(response))
+	assert.Equal(t, "max-age=30", header.Get("Cache-Control"))
+
+	// After the window the resource is gone for good, so the 404 is not bounded
+	clock.now = time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	response, header = get("acct:contractor@example.com")
+	assert.Nil(t, response)
+	assert.Empty(t, header.Get("Cache-Control"))
+
+	// Resources without windows carry no caching headers
+	response, header = get("acct:alice@example.com")
+	require.NotNil(t, response)
+	assert.Empty(t, header.Get("Cache-Control"))
+	assert.Empty(t, header.Get("Expires"))
+}
+
+func TestValidityWindowValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *traefik_webfinger.Config)
+	}{
+		{
+			name: "Invalid resource time",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Resources["acct:alice@example.com"] = traefik_webfinger.WebFingerResponse{Subject: "acct:alice@example.com", NotAfter: "tomorrow"}
+			},
+		},
+		{
+			name: "Empty window",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Resources["acct:alice@example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:alice@example.com", NotBefore: "2030-03-01", NotAfter: "2030-03-01T00:00:00Z",
+				}
+			},
+		},
+		{
+			name: "Invalid link time",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Resources["acct:alice@example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:alice@example.com",
+					Links:   []traefik_webfinger.WebFingerLink{{Rel: "self", NotBefore: "2030-13-01"}},
+				}
+			},
+		},
+		{
+			name: "Invalid default link time",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.DefaultLinks = []traefik_webfinger.WebFingerLink{{Rel: "self", NotBefore: "soon"}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			tt.modify(cfg)
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, traefik_webfinger.ErrInvalidValidity)
+		})
+	}
+}
+
+func TestValidityWindowSources(t *testing.T) {
+	windowed := func(subject string) traefik_webfinger.WebFingerResponse {
+		return traefik_webfinger.WebFingerResponse{
+			Subject:  subject,
+			NotAfter: "2030-03-01",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Href: "https://example.com/users/alice"},
+				{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/avatar.png", NotAfter: "2030-02-01"},
+			},
+		}
+	}
+
+	encode := func(t *testing.T, value interface{}) string {
+		t.Helper()
+
+		encoded, err := json.Marshal(value)
+		require.NoError(t, err)
+
+		return string(encoded)
+	}
+
+	tests := []struct {
+		name     string
+		resource string
+		modify   func(t *testing.T, cfg *traefik_webfinger.Config)
+	}{
+		{
+			name:     "Resources file",
+			resource: "acct:alice@example.com",
+			modify: func(t *testing.T, cfg *traefik_webfinger.Config) {
+				cfg.ResourcesFile = filepath.Join(t.TempDir(), "resources.json")
+				resources := map[string]traefik_webfinger.WebFingerResponse{"acct:alice@example.com": windowed("acct:alice@example.com")}
+				writeResourcesFile(t, cfg.ResourcesFile, encode(t, resources), time.Now())
+			},
+		},
+		{
+			name:     "Resources directory",
+			resource: "acct:alice@example.com",
+			modify: func(t *testing.T, cfg *traefik_webfinger.Config) {
+				cfg.ResourcesDir = t.TempDir()
+				writeResourcesFile(t, filepath.Join(cfg.ResourcesDir, "alice.json"), encode(t, windowed("acct:alice@example.com")), time.Now())
+			},
+		},
+		{
+			name:     "Resource template",
+			resource: "acct:alice@example.com",
+			modify: func(t *testing.T, cfg *traefik_webfinger.Config) {
+				cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+					"acct:{user}@example.com": windowed("acct:{user}@example.com"),
+				}
+			},
+		},
+		{
+			name:     "Resource rule",
+			resource: "urn:example:employee:1234",
+			modify: func(t *testing.T, cfg *traefik_webfinger.Config) {
+				cfg.ResourceRules = []traefik_webfinger.ResourceRule{
+					{Match: `urn:example:employee:(?P<id>[0-9]+)`, Response: windowed("urn:example:employee:{id}")},
+				}
+			},
+		},
+		{
+			name:     "Upstream",
+			resource: "acct:alice@example.com",
+			modify: func(t *testing.T, cfg *traefik_webfinger.Config) {
+				directory := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					_ = json.NewEncoder(rw).Encode(windowed(req.URL.Query().Get("resource")))
+				}))
+				t.Cleanup(directory.Close)
+
+				cfg.Upstream = traefik_webfinger.UpstreamConfig{URL: directory.URL + "/jrd?resource={resource}"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "example.com"
+			tt.modify(t, cfg)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			handler, err := traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+			require.NoError(t, err)
+
+			clock := &fakeClock{now: time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC)}
+			traefik_webfinger.SetClock(handler, clock.Now)
+
+			recorder := getResource(handler, tt.resource)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), "avatar.png")
+			assert.NotContains(t, recorder.Body.String(), "notAfter")
+			assert.Equal(t, "Fri, 01 Feb 2030 00:00:00 GMT", recorder.Header().Get("Expires"))
+
+			clock.now = time.Date(2030, 2, 15, 0, 0, 0, 0, time.UTC)
+			recorder = getResource(handler, tt.resource)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.NotContains(t, recorder.Body.String(), "avatar.png")
+
+			clock.now = time.Date(2030, 3, 15, 0, 0, 0, 0, time.UTC)
+			assert.Equal(t, http.StatusNotFound, statusOf(handler, tt.resource))
+		})
+	}
+}
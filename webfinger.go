@@ -6,179 +6,741 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
+const webfingerPath = "/.well-known/webfinger"
+
 // Define static errors.
 var (
-	ErrDomainRequired      = errors.New("domain must be specified")
-	ErrResourceDomainMatch = errors.New("resource does not match configured domain")
-	ErrSubjectRequired     = errors.New("subject is required for resource")
-	ErrRelRequired         = errors.New("rel is required for links in resource")
+	ErrDomainRequired        = errors.New("domain must be specified")
+	ErrInvalidDomain         = errors.New("invalid domain")
+	ErrResourceDomainMatch   = errors.New("resource does not match configured domain")
+	ErrSubjectRequired       = errors.New("subject is required for resource")
+	ErrRelRequired           = errors.New("rel is required for links in resource")
+	ErrInvalidLinkTemplate   = errors.New("invalid link template")
+	ErrInvalidPropertyName   = errors.New("property names must be URIs")
+	ErrInvalidCORSOrigin     = errors.New("invalid CORS allowed origin")
+	ErrInvalidCORSMaxAge     = errors.New("CORS max age must not be negative")
+	ErrInvalidTemplate       = errors.New("invalid resource template")
+	ErrInvalidResourcesFile  = errors.New("invalid resources file")
+	ErrInvalidReloadInterval = errors.New("invalid reload interval")
+	ErrDuplicateResource     = errors.New("resource defined more than once")
+	ErrDuplicateAlias        = errors.New("alias claimed by more than one resource")
+	ErrInvalidDelegation     = errors.New("invalid delegation rule")
+	ErrInvalidMerge          = errors.New("invalid merge configuration")
+	ErrInvalidRewrite        = errors.New("invalid rewrite origin")
+	ErrInvalidEnforceHTTPS   = errors.New("invalid HTTPS enforcement mode")
+	ErrInvalidTrustedProxy   = errors.New("invalid trusted proxy")
+	ErrInvalidHostMismatch   = errors.New("invalid host mismatch behavior")
+	ErrInvalidDomainAlias    = errors.New("invalid domain alias")
+	ErrInvalidResourceRule   = errors.New("invalid resource rule")
+	ErrInvalidTombstone      = errors.New("invalid tombstone")
+	ErrInvalidValidity       = errors.New("invalid validity window")
+	ErrUnknownProfile        = errors.New("unknown link profile")
+	ErrProfileCycle          = errors.New("link profiles extend each other in a cycle")
+	ErrInvalidUpstream       = errors.New("invalid upstream configuration")
+	ErrUpstreamTimeout       = errors.New("upstream timed out")
+	ErrUpstreamUnavailable   = errors.New("upstream unavailable")
+	ErrUpstreamInvalid       = errors.New("upstream returned an invalid document")
 )
 
-// WebFingerResponse represents the WebFinger JSON response according to RFC 7033.
+// WebFingerResponse represents a WebFinger resource (RFC 7033) as configured or loaded. Besides the members of the
+// JSON response, it holds settings that control how the resource is served, which are never part of the response.
 type WebFingerResponse struct {
-	Subject string          `json:"subject"`
-	Aliases []string        `json:"aliases,omitempty"`
-	Links   []WebFingerLink `json:"links,omitempty"`
+	Subject    string             `json:"subject" yaml:"subject"`
+	Aliases    []string           `json:"aliases,omitempty" yaml:"aliases"`
+	Properties map[string]*string `json:"properties,omitempty" yaml:"properties"`
+	Links      []WebFingerLink    `json:"links,omitempty" yaml:"links"`
+	// Link profiles whose links and properties are added to this resource, in order; never served
+	Profiles []string `json:"profiles,omitempty" yaml:"profiles"`
+	// Default link rels and property names left out of this resource, "*" for all of them; never served
+	ExcludeDefaults []string `json:"excludeDefaults,omitempty" yaml:"excludeDefaults"`
+	// RFC 3339 time or date before which the resource is not served; never served
+	NotBefore string `json:"notBefore,omitempty" yaml:"notBefore"`
+	// RFC 3339 time or date after which the resource is not served; never served
+	NotAfter string `json:"notAfter,omitempty" yaml:"notAfter"`
 }
 
 // WebFingerLink represents a link in the WebFinger response.
 type WebFingerLink struct {
-	Rel        string            `json:"rel"`
-	Type       string            `json:"type,omitempty"`
-	Href       string            `json:"href,omitempty"`
-	Titles     map[string]string `json:"titles,omitempty"`
-	Properties map[string]string `json:"properties,omitempty"`
+	Rel        string             `json:"rel" yaml:"rel"`
+	Type       string             `json:"type,omitempty" yaml:"type"`
+	Href       string             `json:"href,omitempty" yaml:"href"`
+	Template   string             `json:"template,omitempty" yaml:"template"`
+	Titles     map[string]string  `json:"titles,omitempty" yaml:"titles"`
+	Properties map[string]*string `json:"properties,omitempty" yaml:"properties"`
+	// RFC 3339 time or date before which the link is not served; never served
+	NotBefore string `json:"notBefore,omitempty" yaml:"notBefore"`
+	// RFC 3339 time or date after which the link is not served; never served
+	NotAfter string `json:"notAfter,omitempty" yaml:"notAfter"`
 }
 
 // Config defines the plugin configuration structure.
 type Config struct {
 	// The domain this WebFinger service is responsible for
 	Domain string `json:"domain,omitempty" yaml:"domain"`
+	// Additional domains served by the same middleware instance, *.example.com matches one subdomain level
+	Domains []string `json:"domains,omitempty" yaml:"domains"`
+	// Whether wildcard domains such as *.example.com also match their apex example.com
+	WildcardApex bool `json:"wildcardApex,omitempty" yaml:"wildcardApex"`
+	// Secondary domains answered with the resources of a configured domain
+	DomainAliases []DomainAlias `json:"domainAliases,omitempty" yaml:"domainAliases"`
 	// Default resources and their links
 	Resources map[string]WebFingerResponse `json:"resources,omitempty" yaml:"resources"`
+	// Removed resources answered with 410 Gone until they expire
+	Tombstones map[string]Tombstone `json:"tombstones,omitempty" yaml:"tombstones"`
+	// JSON or YAML file with additional resources, reloaded when it changes
+	ResourcesFile string `json:"resourcesFile,omitempty" yaml:"resourcesFile"`
+	// Directory of JRD files, one resource per .json file keyed by its subject
+	ResourcesDir string `json:"resourcesDir,omitempty" yaml:"resourcesDir"`
+	// How often external resource sources are checked for changes, 10s by default
+	ReloadInterval string `json:"reloadInterval,omitempty" yaml:"reloadInterval"`
+	// Resources generated for every user, keyed by a pattern such as acct:{user}@example.com
+	ResourceTemplates map[string]WebFingerResponse `json:"resourceTemplates,omitempty" yaml:"resourceTemplates"`
+	// Named sets of links and properties that resources reference in their profiles
+	Profiles map[string]LinkProfile `json:"profiles,omitempty" yaml:"profiles"`
+	// Links added to every configured response that has no link of the same rel
+	DefaultLinks []WebFingerLink `json:"defaultLinks,omitempty" yaml:"defaultLinks"`
+	// Properties added to every configured response that has no property of the same name
+	DefaultProperties map[string]*string `json:"defaultProperties,omitempty" yaml:"defaultProperties"`
+	// Ordered rules answering resources that match regular expressions, after resources and templates
+	ResourceRules []ResourceRule `json:"resourceRules,omitempty" yaml:"resourceRules"`
+	// User names resource templates may resolve, all users when empty
+	AllowedUsers []string `json:"allowedUsers,omitempty" yaml:"allowedUsers"`
+	// User names resource templates never resolve
+	DeniedUsers []string `json:"deniedUsers,omitempty" yaml:"deniedUsers"`
+	// HTTP directory queried for resources that are not configured
+	Upstream UpstreamConfig `json:"upstream,omitempty" yaml:"upstream"`
+	// Rules redirecting queries to other WebFinger servers
+	Delegations []DelegationRule `json:"delegations,omitempty" yaml:"delegations"`
 	// Whether to pass through to the backend service if resource not found
 	Passthrough bool `json:"passthrough,omitempty" yaml:"passthrough"`
+	// Merging of configured resources into the backend JRD documents
+	Merge MergeConfig `json:"merge,omitempty" yaml:"merge"`
+	// Rules mapping internal origins to public ones in backend JRD documents
+	Rewrites []RewriteRule `json:"rewrites,omitempty" yaml:"rewrites"`
+	// What to do with plain HTTP requests: serve them (default), "redirect" or "reject"
+	EnforceHTTPS string `json:"enforceHTTPS,omitempty" yaml:"enforceHTTPS"`
+	// IP addresses or CIDR ranges of proxies whose forwarding headers are trusted
+	TrustedProxies []string `json:"trustedProxies,omitempty" yaml:"trustedProxies"`
+	// Whether the request host selects which domain's resources are served
+	HostBinding bool `json:"hostBinding,omitempty" yaml:"hostBinding"`
+	// What to do when host binding rejects a request: "notfound" (default) or "passthrough"
+	HostMismatch string `json:"hostMismatch,omitempty" yaml:"hostMismatch"`
+	// Cross-Origin Resource Sharing settings
+	CORS CORSConfig `json:"cors,omitempty" yaml:"cors"`
+	// Host-meta documents served alongside WebFinger
+	HostMeta HostMetaConfig `json:"hostMeta,omitempty" yaml:"hostMeta"`
 }
 
 // CreateConfig creates a new default plugin configuration.
 func CreateConfig() *Config {
 	return &Config{
-		Domain:      "",
-		Resources:   make(map[string]WebFingerResponse),
-		Passthrough: false,
+		Domain:            "",
+		Domains:           []string{},
+		Resources:         make(map[string]WebFingerResponse),
+		ResourceTemplates: make(map[string]WebFingerResponse),
+		Passthrough:       false,
+		CORS: CORSConfig{
+			AllowedOrigins: []string{corsAnyOrigin},
+		},
 	}
 }
 
 // WebFinger is the middleware plugin implementation.
 type WebFinger struct {
-	next        http.Handler
-	name        string
-	domain      string
-	resources   map[string]WebFingerResponse
-	passthrough bool
+	next           http.Handler
+	name           string
+	domains        []string
+	domainAliases  []domainAlias
+	resources      *resourceStore
+	tombstones     map[string]tombstone
+	templates      []resourceTemplate
+	rules          []resourceRule
+	users          userFilter
+	upstream       *upstream
+	delegations    []delegation
+	passthrough    bool
+	merge          MergeConfig
+	rewrites       []rewriteRule
+	enforceHTTPS   string
+	trustedProxies trustedProxies
+	hostBinding    bool
+	hostMismatch   string
+	cors           *corsPolicy
+	hostMeta       bool
+	hostMetaLinks  resourceEntry
+	clock          func() time.Time
 }
 
 // New creates a new WebFinger middleware plugin.
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	if config.Domain == "" {
+	domains := configuredDomains(config)
+	if len(domains) == 0 {
 		return nil, ErrDomainRequired
 	}
 
-	// Validate resources
-	for resource, response := range config.Resources {
-		if !isResourceForDomain(resource, config.Domain) {
-			return nil, fmt.Errorf("%w: %s for domain %s", ErrResourceDomainMatch, resource, config.Domain)
+	if err := validateDomains(domains); err != nil {
+		return nil, err
+	}
+
+	if err := validateResources(config.Resources, domains); err != nil {
+		return nil, err
+	}
+
+	tombstones, err := newTombstones(config.Tombstones, domains, config.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := newLinkProfiles(config.Profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := profiles.validateAll(config.Resources); err != nil {
+		return nil, err
+	}
+
+	defaults, err := newResponseDefaults(config.DefaultLinks, config.DefaultProperties, profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	domainAliases, err := newDomainAliases(config.DomainAliases, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	// Profiles, defaults and validity windows are applied once when resources are loaded, rather than on every request
+	templates, err := newResourceTemplates(config.ResourceTemplates, domains, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := newResourceRules(config.ResourceRules, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	cors, err := newCORSPolicy(config.CORS)
+	if err != nil {
+		return nil, err
+	}
+
+	hostMetaLinks, err := newHostMetaLinks(config.HostMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateMerge(config.Merge); err != nil {
+		return nil, err
+	}
+
+	rewrites, err := newRewriteRules(config.Rewrites)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateEnforceHTTPS(config.EnforceHTTPS); err != nil {
+		return nil, err
+	}
+
+	proxies, err := newTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateHostMismatch(config.HostMismatch); err != nil {
+		return nil, err
+	}
+
+	interval, err := parseReloadInterval(config.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	delegations, err := newDelegations(config.Delegations, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	var directory *upstream
+	if config.Upstream.URL != "" {
+		if directory, err = newUpstream(config.Upstream, defaults); err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := newResourceStore(config.Resources, domains, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	webfinger := &WebFinger{
+		next:           next,
+		name:           name,
+		domains:        domains,
+		domainAliases:  domainAliases,
+		resources:      store,
+		tombstones:     tombstones,
+		templates:      templates,
+		rules:          rules,
+		users:          newUserFilter(config.AllowedUsers, config.DeniedUsers),
+		upstream:       directory,
+		delegations:    delegations,
+		passthrough:    config.Passthrough,
+		merge:          config.Merge,
+		rewrites:       rewrites,
+		enforceHTTPS:   config.EnforceHTTPS,
+		trustedProxies: proxies,
+		hostBinding:    config.HostBinding,
+		hostMismatch:   config.HostMismatch,
+		cors:           cors,
+		hostMeta:       config.HostMeta.Enabled,
+		hostMetaLinks:  hostMetaLinks,
+		clock:          time.Now,
+	}
+
+	if config.ResourcesFile != "" {
+		info, err := os.Stat(config.ResourcesFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading resources file: %w", err)
 		}
 
-		if response.Subject == "" {
-			return nil, fmt.Errorf("%w: %s", ErrSubjectRequired, resource)
+		resources, err := loadResourcesFile(config.ResourcesFile, domains, profiles)
+		if err != nil {
+			return nil, err
 		}
 
-		for _, link := range response.Links {
-			if link.Rel == "" {
-				return nil, fmt.Errorf("%w: %s", ErrRelRequired, resource)
-			}
+		if err := webfinger.resources.set(layerFile, resources); err != nil {
+			return nil, fmt.Errorf("%s: %w", config.ResourcesFile, err)
+		}
+
+		go webfinger.watchResourcesFile(ctx, config.ResourcesFile, interval, info)
+	}
+
+	if config.ResourcesDir != "" {
+		dir, err := newResourcesDir(config.ResourcesDir, domains, profiles)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := webfinger.refreshResourcesDir(dir); err != nil {
+			return nil, err
 		}
+
+		go webfinger.watchResourcesDir(ctx, dir, interval)
 	}
 
-	return &WebFinger{
-		next:        next,
-		name:        name,
-		domain:      config.Domain,
-		resources:   config.Resources,
-		passthrough: config.Passthrough,
-	}, nil
+	return webfinger, nil
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (w *WebFinger) ServeHTTP(responseWriter http.ResponseWriter, req *http.Request) {
-	// Only handle WebFinger requests to the well-known path
-	if !strings.HasPrefix(req.URL.Path, "/.well-known/webfinger") {
+	// Only handle WebFinger and host-meta requests to the well-known paths
+	path := req.URL.Path
+	isHostMeta := w.hostMeta && (path == hostMetaPath || path == hostMetaJSONPath)
+
+	if !isHostMeta && !strings.HasPrefix(path, webfingerPath) {
 		w.next.ServeHTTP(responseWriter, req)
 		return
 	}
 
-	// WebFinger only works with GET requests
-	if req.Method != http.MethodGet {
-		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+	// CORS preflights are answered before HTTPS is enforced, as browsers do not follow redirects for them
+	if !w.allowMethod(responseWriter, req) || !w.requireHTTPS(responseWriter, req) {
+		return
+	}
+
+	if isHostMeta {
+		if w.hostBinding && !w.servesHost(req, "") {
+			w.rejectHost(responseWriter, req)
+			return
+		}
+
+		w.serveHostMeta(responseWriter, req)
+
 		return
 	}
 
 	// Extract the resource parameter
-	resource := req.URL.Query().Get("resource")
+	query := req.URL.Query()
+	resource := query.Get("resource")
 	if resource == "" {
+		w.cors.setHeaders(responseWriter.Header(), req)
 		http.Error(responseWriter, "Resource parameter is required", http.StatusBadRequest)
+
 		return
 	}
 
-	// Check if the resource belongs to the configured domain
-	if !isResourceForDomain(resource, w.domain) {
-		if w.passthrough {
-			w.next.ServeHTTP(responseWriter, req)
-			return
+	// Check if the resource belongs to one of the configured domains or domain aliases
+	var alias domainAlias
+
+	aliased, hostResource := false, resource
+	if _, ok := matchDomain(resource, w.domains); !ok {
+		if alias, aliased = w.matchDomainAlias(resource); !aliased {
+			// Resource rules also answer URIs without a configured domain, such as urn:example:employee:1234
+			if !w.matchesResourceRule(resource) {
+				w.notFound(responseWriter, req)
+				return
+			}
+
+			hostResource = ""
 		}
+	}
+
+	// With host binding, only the domain the request was sent to is eligible
+	if w.hostBinding && !w.servesHost(req, hostResource) {
+		w.rejectHost(responseWriter, req)
+		return
+	}
+
+	// Resources of domain aliases are answered with those of their target domain
+	if aliased {
+		resource = alias.canonical(resource)
+	}
 
-		http.Error(responseWriter, "Resource not found", http.StatusNotFound)
+	// Delegated domains and patterns are redirected before any local lookup
+	if w.delegate(responseWriter, req, resource, false) {
+		return
+	}
 
+	// Removed accounts are gone rather than unknown until their tombstone expires
+	if w.serveTombstone(responseWriter, req, resource) {
 		return
 	}
 
-	// If the resource is specified in our configuration, return it
-	if response, exists := w.resources[resource]; exists {
-		responseWriter.Header().Set("Content-Type", "application/jrd+json")
-		responseWriter.WriteHeader(http.StatusOK)
+	// If the resource is specified in our configuration or matches a template, return it
+	entry, exists := w.lookup(resource)
+	if !exists && w.upstream != nil {
+		var err error
+
+		entry, exists, err = w.upstream.resolve(req.Context(), resource)
+		if err != nil {
+			log.Printf("webfinger %s: resolving %s: %v", w.name, resource, err)
+			w.cors.setHeaders(responseWriter.Header(), req)
+			http.Error(responseWriter, http.StatusText(upstreamStatus(err)), upstreamStatus(err))
 
-		if err := json.NewEncoder(responseWriter).Encode(response); err != nil {
-			http.Error(responseWriter, "Error encoding response", http.StatusInternalServerError)
 			return
 		}
+	}
+
+	// Resources outside their validity window are answered like unknown ones
+	now := w.clock()
+
+	var (
+		response WebFingerResponse
+		changes  time.Time
+	)
+
+	if exists {
+		response, changes, exists = applyValidity(entry, now)
+	}
+
+	if !exists {
+		// A resource whose window opens later must not stay cached as unknown
+		setCacheHeaders(responseWriter.Header(), now, changes)
+
+		if !w.delegate(responseWriter, req, resource, true) {
+			w.notFound(responseWriter, req)
+		}
+
+		return
+	}
+
+	// Enrich the backend document with the configured one
+	if w.merge.Enabled {
+		if backend, ok := w.fetchBackendJRD(req); ok {
+			if w.merge.Precedence == precedenceConfig {
+				response = mergeResponses(response, backend)
+			} else {
+				response = mergeResponses(backend, response)
+			}
+		}
+	}
+
+	if aliased {
+		response = alias.localize(response)
+	}
+
+	// Only return the requested link relations, if any were given
+	if rels := query["rel"]; len(rels) > 0 {
+		response = filterLinks(response, rels)
+	}
+
+	setCacheHeaders(responseWriter.Header(), now, changes)
+	w.writeResponse(responseWriter, req, response, http.StatusOK)
+}
+
+// lookup finds the configured resource, falling back to the first matching resource template, then resource rule.
+func (w *WebFinger) lookup(resource string) (resourceEntry, bool) {
+	if entry, exists := w.resources.get(resource); exists {
+		return entry, true
+	}
+
+	for _, template := range w.templates {
+		if entry, ok := template.render(resource, w.users); ok {
+			return entry, true
+		}
+	}
+
+	// The first matching rule decides, even if it cannot render a response
+	for _, rule := range w.rules {
+		if entry, matched, ok := rule.render(resource, w.domains); matched {
+			return entry, ok
+		}
+	}
+
+	return resourceEntry{}, false
+}
+
+// writeResponse encodes the response in the format negotiated from the Accept header, with the given status.
+func (w *WebFinger) writeResponse(responseWriter http.ResponseWriter, req *http.Request, response WebFingerResponse, status int) {
+	w.cors.setHeaders(responseWriter.Header(), req)
+	responseWriter.Header().Add("Vary", "Accept")
 
+	format, ok := negotiateFormat(req.Header.Get("Accept"))
+	if !ok {
+		http.Error(responseWriter, "Not acceptable", http.StatusNotAcceptable)
 		return
 	}
 
-	// If passthrough is enabled, forward the request to the backend
+	if format == formatXRD {
+		writeXRD(responseWriter, newXRDDocument(response), status)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/jrd+json")
+	responseWriter.WriteHeader(status)
+
+	if err := json.NewEncoder(responseWriter).Encode(newJRDDocument(response)); err != nil {
+		http.Error(responseWriter, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// allowMethod answers CORS preflights and unsupported methods, and reports whether the request should be served.
+func (w *WebFinger) allowMethod(responseWriter http.ResponseWriter, req *http.Request) bool {
+	// WebFinger only works with GET requests, OPTIONS is answered for CORS preflights
+	switch req.Method {
+	case http.MethodGet:
+		return true
+	case http.MethodOptions:
+		w.cors.servePreflight(responseWriter, req)
+	default:
+		w.cors.setHeaders(responseWriter.Header(), req)
+		responseWriter.Header().Set("Allow", allowedMethods)
+		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	return false
+}
+
+// notFound forwards the request to the backend if passthrough is enabled, or returns a 404 otherwise.
+func (w *WebFinger) notFound(responseWriter http.ResponseWriter, req *http.Request) {
 	if w.passthrough {
-		w.next.ServeHTTP(responseWriter, req)
+		w.passToBackend(responseWriter, req)
 		return
 	}
 
-	// Otherwise, return a 404
+	w.cors.setHeaders(responseWriter.Header(), req)
 	http.Error(responseWriter, "Resource not found", http.StatusNotFound)
 }
 
+// filterLinks returns a copy of the response that only contains links matching one of the given relations (RFC 7033 section 4.3).
+func filterLinks(response WebFingerResponse, rels []string) WebFingerResponse {
+	wanted := make(map[string]struct{}, len(rels))
+	for _, rel := range rels {
+		wanted[rel] = struct{}{}
+	}
+
+	links := make([]WebFingerLink, 0, len(response.Links))
+
+	for _, link := range response.Links {
+		if _, ok := wanted[link.Rel]; ok {
+			links = append(links, link)
+		}
+	}
+
+	response.Links = links
+
+	return response
+}
+
+// validateResources checks that every resource belongs to one of the domains and is well formed.
+func validateResources(resources map[string]WebFingerResponse, domains []string) error {
+	names := make([]string, 0, len(resources))
+	owners := make(map[string]string, len(resources))
+
+	for resource := range resources {
+		names = append(names, resource)
+		owners[resource] = resource
+	}
+
+	sort.Strings(names)
+
+	for _, resource := range names {
+		if _, ok := matchDomain(resource, domains); !ok {
+			return fmt.Errorf("%w: %s for domains %s", ErrResourceDomainMatch, resource, strings.Join(domains, ", "))
+		}
+
+		if err := validateResponse(resource, resources[resource]); err != nil {
+			return err
+		}
+
+		if err := claimAliases(owners, resource, resources[resource], domains); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateResponse checks the subject and link relations of a configured resource.
+func validateResponse(resource string, response WebFingerResponse) error {
+	if response.Subject == "" {
+		return fmt.Errorf("%w: %s", ErrSubjectRequired, resource)
+	}
+
+	if err := validateProperties(resource, response.Properties); err != nil {
+		return err
+	}
+
+	if err := validateLinks(resource, response.Links); err != nil {
+		return err
+	}
+
+	return validateValidity(resource, response)
+}
+
+// configuredDomains returns the domain and additional domains of the configuration, without duplicates,
+// followed by the apex of wildcard domains when they match it.
+func configuredDomains(config *Config) []string {
+	domains := make([]string, 0, len(config.Domains)+1)
+	seen := make(map[string]struct{}, len(config.Domains)+1)
+
+	candidates := append([]string{config.Domain}, config.Domains...)
+	if config.WildcardApex {
+		for _, domain := range candidates {
+			if isWildcardDomain(domain) {
+				candidates = append(candidates, strings.TrimPrefix(domain, wildcardPrefix))
+			}
+		}
+	}
+
+	for _, domain := range candidates {
+		if _, ok := seen[domain]; ok || domain == "" {
+			continue
+		}
+
+		seen[domain] = struct{}{}
+		domains = append(domains, domain)
+	}
+
+	return domains
+}
+
+// matchDomain returns the first of the domains the resource belongs to.
+func matchDomain(resource string, domains []string) (string, bool) {
+	for _, domain := range domains {
+		if isResourceForDomain(resource, domain) {
+			return domain, true
+		}
+	}
+
+	return "", false
+}
+
 // isResourceForDomain checks if the resource belongs to the configured domain.
 func isResourceForDomain(resource, domain string) bool {
 	// Resource can be in different formats, most commonly:
 	// acct:user@example.com, https://example.com/user, or mailto:user@example.com
+	resourceAuthority, ok := resourceHost(resource)
+	if !ok {
+		return false
+	}
 
-	const (
-		acctPrefix      = "acct:"
-		acctPrefixLen   = len(acctPrefix)
-		httpsPrefix     = "https://"
-		httpsPrefixLen  = len(httpsPrefix)
-		mailtoPrefix    = "mailto:"
-		mailtoPrefixLen = len(mailtoPrefix)
-		splitLimit      = 2
-	)
+	return domainMatches(domain, resourceAuthority)
+}
+
+// domainMatches reports whether the authority is the domain, or exactly one level below a wildcard domain
+// such as *.example.com, which does not match its apex.
+func domainMatches(domain string, candidate authority) bool {
+	wildcard := strings.HasPrefix(domain, wildcardPrefix)
+	domain = strings.TrimPrefix(domain, wildcardPrefix)
+
+	// Accept unbracketed IPv6 literals as domains
+	if strings.Count(domain, ":") > 1 && !strings.HasPrefix(domain, "[") {
+		domain = "[" + domain + "]"
+	}
+
+	domainAuthority, ok := parseAuthority(domain, "")
+	if !ok {
+		return false
+	}
+
+	if !wildcard {
+		return candidate == domainAuthority
+	}
+
+	label, parent, found := strings.Cut(candidate.host, ".")
+
+	return found && label != "" && parent == domainAuthority.host && candidate.port == domainAuthority.port
+}
 
-	if strings.HasPrefix(resource, acctPrefix) {
-		parts := strings.SplitN(resource[acctPrefixLen:], "@", splitLimit)
-		return len(parts) == splitLimit && parts[1] == domain
+// authority is a normalized host and port, the port being empty when it is the default one of the scheme.
+type authority struct {
+	host string
+	port string
+}
+
+// resourceHost returns the authority a resource URI refers to: the part after the last "@" for opaque URIs
+// such as acct: and mailto: (whose local part may itself contain "@"), or the host of hierarchical URIs such as https:.
+func resourceHost(resource string) (authority, bool) {
+	parsed, err := url.Parse(resource)
+	if err != nil || parsed.Scheme == "" {
+		return authority{}, false
+	}
+
+	if parsed.Opaque != "" {
+		at := strings.LastIndex(parsed.Opaque, "@")
+		if at < 0 {
+			return authority{}, false
+		}
+
+		return parseAuthority(parsed.Opaque[at+1:], "")
 	}
 
-	if strings.HasPrefix(resource, httpsPrefix) {
-		return strings.Contains(resource[httpsPrefixLen:], domain)
+	if parsed.Hostname() == "" {
+		return authority{}, false
 	}
 
-	if strings.HasPrefix(resource, mailtoPrefix) {
-		parts := strings.SplitN(resource[mailtoPrefixLen:], "@", splitLimit)
-		return len(parts) == splitLimit && parts[1] == domain
+	return newAuthority(parsed.Hostname(), parsed.Port(), parsed.Scheme), true
+}
+
+// parseAuthority parses a bare host with an optional port, such as example.com, example.com:8443 or [::1]:8443.
+func parseAuthority(value, scheme string) (authority, bool) {
+	parsed, err := url.Parse("//" + value)
+	if err != nil || parsed.User != nil || parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" ||
+		parsed.Hostname() == "" || strings.ContainsAny(value, "?#") {
+		return authority{}, false
+	}
+
+	return newAuthority(parsed.Hostname(), parsed.Port(), scheme), true
+}
+
+// newAuthority normalizes the host name case, a trailing dot and the default port of the scheme.
+func newAuthority(host, port, scheme string) authority {
+	defaultPorts := map[string]string{"http": "80", "https": "443"}
+	if port == defaultPorts[strings.ToLower(scheme)] {
+		port = ""
 	}
 
-	// For other resource types, check if the domain is part of the resource
-	return strings.Contains(resource, domain)
+	return authority{host: strings.TrimSuffix(strings.ToLower(host), "."), port: port}
 }
@@ -6,13 +6,48 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	traefik_webfinger "github.com/NX211/traefik-webfinger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// writeResourcesFile writes the file and moves its modification time forward so the change is always noticed.
+func writeResourcesFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// getResource queries the WebFinger endpoint for the resource.
+func getResource(handler http.Handler, resource string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+resource, nil))
+
+	return recorder
+}
+
+// statusOf returns the status code of a query for the resource.
+func statusOf(handler http.Handler, resource string) int {
+	return getResource(handler, resource).Code
+}
+
+// propertyMap converts string properties into their nullable form.
+func propertyMap(values map[string]string) map[string]*string {
+	properties := make(map[string]*string, len(values))
+	for name, value := range values {
+		value := value
+		properties[name] = &value
+	}
+
+	return properties
+}
+
 func TestWebFinger(t *testing.T) {
 	cfg := traefik_webfinger.CreateConfig()
 	cfg.Domain = "example.com"
@@ -108,6 +143,86 @@ func TestWebFinger(t *testing.T) {
 	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
 }
 
+func TestWebFingerRelFilter(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Aliases: []string{"https://example.com/alice"},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: "https://example.com/alice"},
+				{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/alice"},
+				{Rel: "http://openid.net/specs/connect/1.0/issuer", Href: "https://auth.example.com"},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "No rel",
+			query:    "",
+			expected: []string{"http://webfinger.net/rel/profile-page", "self", "http://openid.net/specs/connect/1.0/issuer"},
+		},
+		{
+			name:     "Single rel",
+			query:    "&rel=self",
+			expected: []string{"self"},
+		},
+		{
+			name:     "Multiple rels",
+			query:    "&rel=self&rel=http%3A%2F%2Fopenid.net%2Fspecs%2Fconnect%2F1.0%2Fissuer",
+			expected: []string{"self", "http://openid.net/specs/connect/1.0/issuer"},
+		},
+		{
+			name:     "Unknown rel",
+			query:    "&rel=http%3A%2F%2Fexample.com%2Frel%2Funknown",
+			expected: nil,
+		},
+		{
+			name:     "URL-encoded rel",
+			query:    "&rel=http%3A%2F%2Fwebfinger.net%2Frel%2Fprofile-page",
+			expected: []string{"http://webfinger.net/rel/profile-page"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+				"/.well-known/webfinger?resource=acct%3Aalice%40example.com"+tt.query, nil)
+			require.NoError(t, err)
+
+			handler.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var response traefik_webfinger.WebFingerResponse
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+			// Subject and aliases are never filtered
+			assert.Equal(t, "acct:alice@example.com", response.Subject)
+			assert.Equal(t, []string{"https://example.com/alice"}, response.Aliases)
+
+			var rels []string
+			for _, link := range response.Links {
+				rels = append(rels, link.Rel)
+			}
+
+			assert.Equal(t, tt.expected, rels)
+		})
+	}
+}
+
 func TestPassthrough(t *testing.T) {
 	cfg := traefik_webfinger.CreateConfig()
 	cfg.Domain = "example.com"
@@ -145,6 +260,120 @@ func TestPassthrough(t *testing.T) {
 	assert.Equal(t, http.StatusOK, recorder.Code)
 }
 
+func TestMultipleDomains(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Domains = []string{"example.org", "team.example.net"}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com":      {Subject: "acct:alice@example.com"},
+		"acct:bob@example.org":        {Subject: "acct:bob@example.org"},
+		"acct:carol@team.example.net": {Subject: "acct:carol@team.example.net"},
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		resource     string
+		expectedCode int
+	}{
+		{resource: "acct:alice@example.com", expectedCode: http.StatusOK},
+		{resource: "acct:bob@example.org", expectedCode: http.StatusOK},
+		{resource: "acct:carol@team.example.net", expectedCode: http.StatusOK},
+		{resource: "acct:dave@example.org", expectedCode: http.StatusNotFound},
+		{resource: "acct:alice@example.net", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/.well-known/webfinger?resource="+tt.resource, nil)
+		require.NoError(t, err)
+
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, tt.expectedCode, recorder.Code, tt.resource)
+	}
+}
+
+func TestAliasLookup(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject: "acct:alice@example.com",
+			Aliases: []string{
+				"https://example.com/@alice",
+				"https://social.example.net/users/alice",
+			},
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "self", Href: "https://example.com/users/alice"},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	handler, err := traefik_webfinger.New(ctx, next, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// Aliases resolve to the canonical record
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/.well-known/webfinger?resource=https://example.com/@alice", nil)
+	require.NoError(t, err)
+
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, "acct:alice@example.com", response.Subject)
+	assert.Equal(t, "https://example.com/users/alice", response.Links[0].Href)
+
+	// Aliases outside of the configured domains are not served
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "/.well-known/webfinger?resource=https://social.example.net/users/alice", nil)
+	require.NoError(t, err)
+
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestMutuallyAliasedResources(t *testing.T) {
+	resourcesFile := filepath.Join(t.TempDir(), "resources.json")
+	writeResourcesFile(t, resourcesFile, `{
+		"https://example.com/bob": {"subject": "https://example.com/bob", "aliases": ["acct:bob@example.com"]}
+	}`, time.Now())
+
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.ResourcesFile = resourcesFile
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com":    {Subject: "acct:alice@example.com", Aliases: []string{"https://example.com/alice"}},
+		"https://example.com/alice": {Subject: "https://example.com/alice", Aliases: []string{"acct:alice@example.com"}},
+		"acct:bob@example.com":      {Subject: "acct:bob@example.com", Aliases: []string{"https://example.com/bob"}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := traefik_webfinger.New(ctx, http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	// Each resource key answers with its own record, within a source and across sources
+	for _, resource := range []string{
+		"acct:alice@example.com", "https://example.com/alice", "acct:bob@example.com", "https://example.com/bob",
+	} {
+		recorder := getResource(handler, resource)
+		require.Equal(t, http.StatusOK, recorder.Code, resource)
+		assert.Contains(t, recorder.Body.String(), `"subject":"`+resource+`"`)
+	}
+}
+
 func TestConfigValidation(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -189,6 +418,64 @@ func TestConfigValidation(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "Valid config with domains only",
+			config: &traefik_webfinger.Config{
+				Domains: []string{"example.com", "example.org"},
+				Resources: map[string]traefik_webfinger.WebFingerResponse{
+					"acct:user@example.org": {
+						Subject: "acct:user@example.org",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Resource outside of all domains",
+			config: &traefik_webfinger.Config{
+				Domain:  "example.com",
+				Domains: []string{"example.org"},
+				Resources: map[string]traefik_webfinger.WebFingerResponse{
+					"acct:user@example.net": {
+						Subject: "acct:user@example.net",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Alias claimed by two resources",
+			config: &traefik_webfinger.Config{
+				Domain: "example.com",
+				Resources: map[string]traefik_webfinger.WebFingerResponse{
+					"acct:alice@example.com": {
+						Subject: "acct:alice@example.com",
+						Aliases: []string{"https://example.com/team"},
+					},
+					"acct:bob@example.com": {
+						Subject: "acct:bob@example.com",
+						Aliases: []string{"https://example.com/team"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Alias that is another resource",
+			config: &traefik_webfinger.Config{
+				Domain: "example.com",
+				Resources: map[string]traefik_webfinger.WebFingerResponse{
+					"acct:alice@example.com": {
+						Subject: "acct:alice@example.com",
+						Aliases: []string{"acct:bob@example.com"},
+					},
+					"acct:bob@example.com": {
+						Subject: "acct:bob@example.com",
+					},
+				},
+			},
+			expectError: false,
+		},
 		{
 			name: "Missing subject",
 			config: &traefik_webfinger.Config{
@@ -234,3 +521,71 @@ func TestConfigValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestSettingsNotServed(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "example.com"
+	cfg.Merge.Enabled = true
+	cfg.Profiles = map[string]traefik_webfinger.LinkProfile{
+		"staff": {Links: []traefik_webfinger.WebFingerLink{{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/staff"}}},
+	}
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {
+			Subject:         "acct:alice@example.com",
+			Profiles:        []string{"staff"},
+			ExcludeDefaults: []string{"*"},
+			NotBefore:       "2020-01-01",
+			Links:           []traefik_webfinger.WebFingerLink{{Rel: "self", Href: "https://example.com/users/alice", NotBefore: "2020-01-01"}},
+		},
+	}
+	cfg.HostMeta = traefik_webfinger.HostMetaConfig{
+		Enabled: true,
+		Links:   []traefik_webfinger.WebFingerLink{{Rel: "http://openid.net/specs/connect/1.0/issuer", Href: "https://auth.example.com", NotBefore: "2020-01-01"}},
+	}
+
+	// The backend document carries the same members, which are not honored for it either
+	backend := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/jrd+json")
+		_, err := io.WriteString(rw, `{
+			"subject": "acct:alice@example.com",
+			"profiles": ["staff"],
+			"excludeDefaults": ["*"],
+			"links": [{"rel": "http://webfinger.net/rel/avatar", "href": "https://example.com/avatar.png", "notAfter": "2099-01-01"}]
+		}`)
+		require.NoError(t, err)
+	})
+
+	handler, err := traefik_webfinger.New(context.Background(), backend, cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		target string
+		accept string
+	}{
+		{name: "JRD", target: "/.well-known/webfinger?resource=acct:alice@example.com"},
+		{name: "XRD", target: "/.well-known/webfinger?resource=acct:alice@example.com", accept: "application/xrd+xml"},
+		{name: "Host-meta", target: "/.well-known/host-meta"},
+		{name: "Host-meta JSON", target: "/.well-known/host-meta.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			body := recorder.Body.String()
+			assert.Contains(t, body, "https://example.com")
+
+			for _, member := range []string{"profiles", "excludeDefaults", "notBefore", "notAfter"} {
+				assert.NotContains(t, body, member)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package traefik_webfinger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// wildcardPrefix marks domains matching every subdomain one level below, such as *.example.com.
+const wildcardPrefix = "*."
+
+// validateDomains checks that wildcards only appear as the whole leftmost label of a domain.
+func validateDomains(domains []string) error {
+	for _, domain := range domains {
+		parent := strings.TrimPrefix(domain, wildcardPrefix)
+		if strings.Contains(parent, "*") {
+			return fmt.Errorf("%w: %q, wildcards must be the leftmost label", ErrInvalidDomain, domain)
+		}
+
+		if parent != domain && strings.HasPrefix(parent, "[") {
+			return fmt.Errorf("%w: %q, IP addresses have no subdomains", ErrInvalidDomain, domain)
+		}
+	}
+
+	return nil
+}
+
+// isWildcardDomain reports whether the domain matches subdomains.
+func isWildcardDomain(domain string) bool {
+	return strings.HasPrefix(domain, wildcardPrefix)
+}
+
+// isServedHost reports whether the host name is one of the domains or a subdomain matched by a wildcard domain.
+func isServedHost(host string, domains []string) bool {
+	candidate, ok := parseAuthority(host, "")
+	if !ok {
+		return false
+	}
+
+	for _, domain := range domains {
+		if domainMatches(domain, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,182 @@
+package traefik_webfinger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefik_webfinger "github.com/NX211/traefik-webfinger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWildcardDomains(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "*.example.com"
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@{subdomain}.example.com": {
+			Subject: "acct:{user}@{subdomain}.example.com",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://webfinger.net/rel/profile-page", Href: "https://{subdomain}.example.com/people/{user}"},
+			},
+		},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	recorder := getResource(handler, "acct:bob@Payments.example.com")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response traefik_webfinger.WebFingerResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.Equal(t, "acct:bob@payments.example.com", response.Subject)
+	assert.Equal(t, "https://payments.example.com/people/bob", response.Links[0].Href)
+
+	// Only one level below the wildcard, and not the apex unless enabled
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:bob@eu.payments.example.com"))
+	assert.Equal(t, http.StatusNotFound, statusOf(handler, "acct:bob@example.com"))
+}
+
+func TestWildcardApex(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "*.example.com"
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@{subdomain}.example.com": {
+			Subject: "acct:{user}@{subdomain}.example.com",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://webfinger.net/rel/profile-page", Href: "https://{subdomain}.example.com/people/{user}"},
+			},
+		},
+	}
+	cfg.WildcardApex = true
+	cfg.Resources = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:alice@example.com": {Subject: "acct:alice@example.com"},
+	}
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:alice@example.com"))
+	assert.Equal(t, http.StatusOK, statusOf(handler, "acct:bob@payments.example.com"))
+
+	// Without the apex rule the resource is rejected
+	cfg.WildcardApex = false
+
+	_, err = traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	assert.ErrorIs(t, err, traefik_webfinger.ErrResourceDomainMatch)
+}
+
+func TestWildcardHostBinding(t *testing.T) {
+	cfg := traefik_webfinger.CreateConfig()
+	cfg.Domain = "*.example.com"
+	cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+		"acct:{user}@{subdomain}.example.com": {
+			Subject: "acct:{user}@{subdomain}.example.com",
+			Links: []traefik_webfinger.WebFingerLink{
+				{Rel: "http://webfinger.net/rel/profile-page", Href: "https://{subdomain}.example.com/people/{user}"},
+			},
+		},
+	}
+	cfg.HostBinding = true
+	cfg.HostMeta.Enabled = true
+
+	handler, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+	require.NoError(t, err)
+
+	for host, expectedCode := range map[string]int{
+		"payments.example.com": http.StatusOK,
+		"billing.example.com":  http.StatusNotFound,
+		"example.com":          http.StatusNotFound,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:bob@payments.example.com", nil)
+		req.Host = host
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, expectedCode, recorder.Code, host)
+	}
+
+	// Host-meta of a subdomain points at the subdomain itself
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/host-meta", nil)
+	req.Host = "payments.example.com"
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "https://payments.example.com/.well-known/webfinger?resource={uri}")
+}
+
+func TestWildcardValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(cfg *traefik_webfinger.Config)
+		expectErr error
+	}{
+		{
+			name:      "Wildcard inside a label",
+			modify:    func(cfg *traefik_webfinger.Config) { cfg.Domains = []string{"team*.example.com"} },
+			expectErr: traefik_webfinger.ErrInvalidDomain,
+		},
+		{
+			name:      "Nested wildcards",
+			modify:    func(cfg *traefik_webfinger.Config) { cfg.Domains = []string{"*.*.example.com"} },
+			expectErr: traefik_webfinger.ErrInvalidDomain,
+		},
+		{
+			name: "Subdomain variable not captured by the pattern",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Domains = []string{"example.org"}
+				cfg.ResourceTemplates["acct:{user}@example.org"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:{user}@{subdomain}.example.org",
+				}
+			},
+			expectErr: traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name: "Repeated subdomain variable",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.ResourceTemplates["acct:{user}.{subdomain}@{subdomain}.example.com"] = traefik_webfinger.WebFingerResponse{
+					Subject: "acct:{user}@{subdomain}.example.com",
+				}
+			},
+			expectErr: traefik_webfinger.ErrInvalidTemplate,
+		},
+		{
+			name: "Subdomain covered by a wildcard used as domain alias",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.Domains = []string{"example.org"}
+				cfg.DomainAliases = []traefik_webfinger.DomainAlias{{Domain: "team.example.com", Target: "example.org"}}
+			},
+			expectErr: traefik_webfinger.ErrInvalidDomainAlias,
+		},
+		{
+			name: "Wildcard alias target",
+			modify: func(cfg *traefik_webfinger.Config) {
+				cfg.DomainAliases = []traefik_webfinger.DomainAlias{{Domain: "example.co.uk", Target: "*.example.com"}}
+			},
+			expectErr: traefik_webfinger.ErrInvalidDomainAlias,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := traefik_webfinger.CreateConfig()
+			cfg.Domain = "*.example.com"
+			cfg.ResourceTemplates = map[string]traefik_webfinger.WebFingerResponse{
+				"acct:{user}@{subdomain}.example.com": {
+					Subject: "acct:{user}@{subdomain}.example.com",
+					Links: []traefik_webfinger.WebFingerLink{
+						{Rel: "http://webfinger.net/rel/profile-page", Href: "https://{subdomain}.example.com/people/{user}"},
+					},
+				},
+			}
+			tt.modify(cfg)
+
+			_, err := traefik_webfinger.New(context.Background(), http.NotFoundHandler(), cfg, "webfinger-test")
+			assert.ErrorIs(t, err, tt.expectErr)
+		})
+	}
+}
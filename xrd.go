@@ -0,0 +1,147 @@
+package traefik_webfinger
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// undeterminedLanguage is the JRD title key used when no language applies.
+const undeterminedLanguage = "und"
+
+// xsiNamespace is the XML Schema instance namespace, whose nil attribute marks null properties.
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// xrdDocument is the XML form of a resource descriptor (XRD 1.0, RFC 6415).
+type xrdDocument struct {
+	XMLName    xml.Name      `xml:"http://docs.oasis-open.org/ns/xri/xrd-1.0 XRD"`
+	XSI        string        `xml:"xmlns:xsi,attr,omitempty"`
+	Subject    string        `xml:"Subject,omitempty"`
+	Aliases    []string      `xml:"Alias"`
+	Properties []xrdProperty `xml:"Property"`
+	Links      []xrdLink     `xml:"Link"`
+}
+
+// xrdLink is a Link element of an XRD document.
+type xrdLink struct {
+	Rel        string        `xml:"rel,attr"`
+	Type       string        `xml:"type,attr,omitempty"`
+	Href       string        `xml:"href,attr,omitempty"`
+	Template   string        `xml:"template,attr,omitempty"`
+	Titles     []xrdTitle    `xml:"Title"`
+	Properties []xrdProperty `xml:"Property"`
+}
+
+// xrdTitle is a Title element of an XRD link.
+type xrdTitle struct {
+	Lang  string `xml:"xml:lang,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// xrdProperty is a Property element of an XRD document or link.
+type xrdProperty struct {
+	Type  string `xml:"type,attr"`
+	Nil   string `xml:"xsi:nil,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// newXRDLink converts a JRD link into its XRD form.
+func newXRDLink(link WebFingerLink) xrdLink {
+	result := xrdLink{
+		Rel:        link.Rel,
+		Type:       link.Type,
+		Href:       link.Href,
+		Template:   link.Template,
+		Properties: newXRDProperties(link.Properties),
+	}
+
+	for _, lang := range sortedKeys(link.Titles) {
+		title := xrdTitle{Lang: lang, Value: link.Titles[lang]}
+		if lang == undeterminedLanguage {
+			title.Lang = ""
+		}
+
+		result.Titles = append(result.Titles, title)
+	}
+
+	return result
+}
+
+// newXRDProperties converts JRD properties into XRD Property elements, ordered by type. Null values become
+// empty elements with xsi:nil set.
+func newXRDProperties(properties map[string]*string) []xrdProperty {
+	result := make([]xrdProperty, 0, len(properties))
+
+	for _, name := range sortedPropertyNames(properties) {
+		property := xrdProperty{Type: name, Nil: "true"}
+		if value := properties[name]; value != nil {
+			property.Value, property.Nil = *value, ""
+		}
+
+		result = append(result, property)
+	}
+
+	return result
+}
+
+// sortedKeys returns the keys of the map in lexical order.
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// writeXRD encodes the document as an XRD response with the given status.
+func writeXRD(responseWriter http.ResponseWriter, document xrdDocument, status int) {
+	responseWriter.Header().Set("Content-Type", "application/xrd+xml; charset=utf-8")
+	responseWriter.WriteHeader(status)
+
+	if _, err := io.WriteString(responseWriter, xml.Header); err != nil {
+		return
+	}
+
+	encoder := xml.NewEncoder(responseWriter)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(document); err != nil {
+		http.Error(responseWriter, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// newXRDDocument converts a WebFinger response into its XRD form.
+func newXRDDocument(response WebFingerResponse) xrdDocument {
+	document := xrdDocument{
+		Subject:    response.Subject,
+		Aliases:    response.Aliases,
+		Properties: newXRDProperties(response.Properties),
+	}
+
+	for _, link := range response.Links {
+		document.Links = append(document.Links, newXRDLink(link))
+	}
+
+	document.declareXSI()
+
+	return document
+}
+
+// declareXSI declares the XML Schema instance namespace when a property of the document or its links is null.
+func (d *xrdDocument) declareXSI() {
+	properties := append([]xrdProperty{}, d.Properties...)
+	for _, link := range d.Links {
+		properties = append(properties, link.Properties...)
+	}
+
+	for _, property := range properties {
+		if property.Nil != "" {
+			d.XSI = xsiNamespace
+			return
+		}
+	}
+}